@@ -2,6 +2,9 @@ package application
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 type App struct {
@@ -12,9 +15,22 @@ type App struct {
 
 func NewApp(args []string) (app *App, mErr *MultiErr) {
 	app = new(App)
-	app.Ctx = context.Background()
 	app.Out = NewOutput()
+	app.Ctx = app.catchSignals()
 	app.Cfg, mErr = NewConfig(args, app.Out)
 
 	return
 }
+
+// catchSignals returns context cancelled by the first SIGINT/SIGTERM, the second one kills the process.
+func (app *App) catchSignals() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-ctx.Done()
+		stop()
+		app.Out.Log("Interrupted, finishing running requests and saving progress. Repeat to quit immediately.")
+	}()
+
+	return ctx
+}
@@ -1,16 +1,29 @@
 package application
 
-import "fmt"
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
 
 const (
-	Version               = "1.1.4-251124"
-	DefaultFetchDir       = "dumps"
-	DefaultFetchWorkers   = 4
-	DefaultTimeout        = 10
-	DefaultCntDownThreads = 10
-	LimitHashes           = 2000 // Max hashes to read by regex from files other than /objects.
-	DebugPrintEveryFetch  = false
-	RetryAfterXSeconds    = 5
+	Version              = "1.1.4-251124"
+	DefaultFetchDir      = "dumps"
+	DefaultFetchWorkers  = 8 // downloads shared by all repositories
+	DefaultParallelRepos = 2
+	DefaultCheckWorkers  = 10
+	DefaultTimeout       = 10
+	DefaultStallTimeout  = 30
+	LimitHashes          = 2000              // Max hashes to read by regex from files other than /objects.
+	LimitParseSize       = 256 * 1024 * 1024 // Larger files, except packs, are saved without looking for references.
+	DebugPrintEveryFetch = false
+	RetryAfterXSeconds   = 5
 
 	DefaultFetchClientRetryMax    = 4
 	FetchClientRetryWaitMinSec    = 1
@@ -25,33 +38,108 @@ const (
 )
 
 const (
-	CmdCheck    = "check"
-	CmdFetch    = "fetch"
-	CmdIndex    = "index"
-	CmdHelp     = "help"
-	FlagFile    = "file"
-	FlagTimeout = "timeout"
-	FlagRetry   = "retry"
-	FlagUrl     = "url"
-	FlagCsv     = "csv"
+	CmdCheck       = "check"
+	CmdFetch       = "fetch"
+	CmdIndex       = "index"
+	CmdCheckout    = "checkout"
+	CmdHelp        = "help"
+	FlagFile       = "file"
+	FlagTimeout    = "timeout"
+	FlagRetry      = "retry"
+	FlagUrl        = "url"
+	FlagCsv        = "csv"
+	FlagRef        = "ref"
+	FlagRecovery   = "recovery"
+	FlagProxy      = "proxy"
+	FlagTarget     = "target"
+	FlagFormat     = "format"
+	FlagMaxFile    = "max-file-size"
+	FlagMaxRepo    = "max-repo-size"
+	FlagMinSpeed   = "min-speed"
+	FlagStall      = "stall-timeout"
+	FlagRedirect   = "redirects"
+	FlagResolve    = "resolve"
+	FlagRps        = "rps"
+	FlagPerHost    = "max-concurrent-per-host"
+	FlagHeader     = "header"
+	FlagCookie     = "cookie"
+	FlagJar        = "cookie-jar"
+	FlagAgent      = "user-agent"
+	FlagAuth       = "auth"
+	FlagClientCert = "client-cert"
+	FlagClientKey  = "client-key"
+	FlagCACert     = "ca-cert"
+	FlagTLSVerify  = "tls-verify"
+	FlagTLSMin     = "tls-min-version"
+	FlagSNI        = "sni"
+	FlagWorkers    = "workers"
+	FlagParallel   = "parallel-repos"
+	DefaultRef     = "HEAD"
+)
+
+const Redacted = "***"
+
+const (
+	RedirectFollow   = "follow"
+	RedirectSameHost = "same-host"
+	RedirectNever    = "never"
+)
+
+const (
+	FormatText  = "text"
+	FormatJson  = "json"
+	FormatJsonl = "jsonl"
 )
 
 type Config struct {
-	BatchFile  string
-	Command    string
-	DwnDir     string
-	DwnThreads int
-	IndexFile  string
-	OutputDir  string
-	Raw        bool
-	Csv        bool
-	Tree       bool
-	Timeout    int
-	Retry      int
-	URL        string
-	Update     bool
-	UserAgent  string
-	Verbose    bool
+	Auth          string
+	BatchFile     string
+	CACert        string
+	ClientCert    string
+	ClientKey     string
+	Command       string
+	Cookie        string
+	CookieJar     string
+	JarCookies    []*http.Cookie
+	DwnDir        string
+	Format        string
+	IndexFile     string
+	MaxFile       string
+	MaxRepo       string
+	MaxFileSize   int64
+	MaxRepoSize   int64
+	MinSpeed      string
+	MinSpeedBps   int64
+	MaxPerHost    int
+	Rps           float64
+	StallTimeout  int
+	OutputDir     string
+	ParallelRepos int
+	Proxy         string
+	ProxyURL      *url.URL
+	Raw           bool
+	Recovery      bool
+	Redirects     string
+	Resolve       []string
+	Resolved      *utils.SafeMapStrings // host:port -> IP, from --resolve and batch files
+	Csv           bool
+	GitDir        string
+	Headers       []string
+	Header        http.Header // parsed --header values
+	Ref           string
+	TargetDir     string
+	Tree          bool
+	Timeout       int
+	Retry         int
+	SNI           string
+	TLS           *tls.Config
+	TLSMinVersion string
+	TLSVerify     bool
+	URL           string
+	Update        bool
+	UserAgent     string
+	Verbose       bool
+	Workers       int
 }
 
 func NewConfig(args []string, out *Output) (cfg *Config, mErr *MultiErr) {
@@ -65,8 +153,51 @@ func NewConfig(args []string, out *Output) (cfg *Config, mErr *MultiErr) {
 
 	// TODO validate url
 
-	cfg.DwnThreads = DefaultFetchWorkers
+	cfg.ProxyURL, err = parseProxy(cfg.Proxy)
+	mErr.Add(err)
+
+	cfg.Resolved = utils.NewSafeMapStrings()
+	mErr.Add(cfg.parseResolve())
+
+	if len(cfg.Resolve) > 0 && cfg.ProxyURL != nil {
+		mErr.Add(fmt.Errorf("--%s can not be used with --%s, the proxy resolves the host", FlagResolve, FlagProxy))
+	}
+
+	mErr.Add(checkPacing(cfg.Rps, cfg.MaxPerHost))
+
+	cfg.TLS, err = cfg.buildTLSConfig()
+	mErr.Add(err)
+
+	cfg.Header, err = parseHeaders(cfg.Headers)
+	mErr.Add(err)
+
+	if cfg.Auth != "" && !strings.Contains(cfg.Auth, ":") {
+		mErr.Add(fmt.Errorf("invalid --%s, use user:pass", FlagAuth))
+	}
+
+	if cfg.CookieJar != "" {
+		cfg.JarCookies, err = utils.ParseCookieFile(cfg.CookieJar)
+
+		if err != nil {
+			mErr.Add(fmt.Errorf("invalid --%s: %w", FlagJar, err))
+		}
+	}
+
+	mErr.Add(checkFormat(cfg.Format))
+	mErr.Add(checkRedirects(cfg.Redirects))
+
+	cfg.MaxFileSize, err = parseSize(FlagMaxFile, cfg.MaxFile)
+	mErr.Add(err)
+
+	cfg.MaxRepoSize, err = parseSize(FlagMaxRepo, cfg.MaxRepo)
+	mErr.Add(err)
+
+	cfg.MinSpeedBps, err = parseSize(FlagMinSpeed, strings.TrimSuffix(cfg.MinSpeed, "/s"))
+	mErr.Add(err)
+
+	mErr.Add(cfg.setWorkers())
 	out.SetVerbose(cfg.Verbose)
+	out.SetFormat(cfg.Format)
 
 	cfg.DwnDir, err = getAbsolutePath(DefaultFetchDir)
 	mErr.Add(err)
@@ -84,7 +215,11 @@ func NewConfig(args []string, out *Output) (cfg *Config, mErr *MultiErr) {
 }
 
 func (cfg *Config) PrintConfigurationText(out *Output) {
-	msgCommon := "Timeout " + fmt.Sprintf("%d", cfg.Timeout) + " seconds."
+	msgCommon := fmt.Sprintf("%d workers.", cfg.Workers)
+
+	if cfg.Command == CmdFetch && cfg.BatchFile != "" {
+		msgCommon += fmt.Sprintf(" %d repositories in parallel.", cfg.ParallelRepos)
+	}
 
 	if cfg.Update {
 		msgCommon += " Will update existing repository."
@@ -98,17 +233,283 @@ func (cfg *Config) PrintConfigurationText(out *Output) {
 		msgCommon += " Verbose mode."
 	}
 
-	if cfg.UserAgent != "" {
-		cfgArr = append(cfgArr, "User Agent "+cfg.UserAgent)
+	if cfg.Command == CmdCheck || cfg.Command == CmdFetch {
+		msgNetwork, networkArr := cfg.networkConfigurationText()
+		msgCommon = msgNetwork + " " + msgCommon
+		cfgArr = append(cfgArr, networkArr...)
 	}
 
 	if cfg.OutputDir != "" {
 		cfgArr = append(cfgArr, "Logging into "+cfg.OutputDir+".*")
 	}
 
+	if cfg.MaxFileSize > 0 || cfg.MaxRepoSize > 0 {
+		cfgArr = append(cfgArr, fmt.Sprintf("Size limits: file %s, repository %s", sizeLimit(cfg.MaxFileSize), sizeLimit(cfg.MaxRepoSize)))
+	}
+
 	cfgArr = append(cfgArr, msgCommon)
 
 	for _, v := range cfgArr {
 		out.Log(v)
 	}
 }
+
+// networkConfigurationText describes the settings of commands which download, checkout and index do not.
+func (cfg *Config) networkConfigurationText() (msg string, cfgArr []string) {
+	msg = "Timeout " + fmt.Sprintf("%d", cfg.Timeout) + " seconds."
+
+	if cfg.Redirects != "" && cfg.Redirects != RedirectSameHost {
+		msg += " Redirects: " + cfg.Redirects + "."
+	}
+
+	if cfg.StallTimeout > 0 {
+		msg += fmt.Sprintf(" Stalled after %d seconds.", cfg.StallTimeout)
+	}
+
+	if cfg.Rps > 0 {
+		msg += fmt.Sprintf(" %g requests per second per host.", cfg.Rps)
+	}
+
+	if cfg.MaxPerHost > 0 {
+		msg += fmt.Sprintf(" %d concurrent requests per host.", cfg.MaxPerHost)
+	}
+
+	if cfg.MinSpeedBps > 0 {
+		msg += " Minimum speed " + utils.SizeToHumanReadable(cfg.MinSpeedBps) + "/s."
+	}
+
+	if cfg.UserAgent != "" {
+		cfgArr = append(cfgArr, "User Agent "+cfg.UserAgent)
+	}
+
+	for name, values := range cfg.Header {
+		for _, value := range values {
+			cfgArr = append(cfgArr, "Header "+name+": "+RedactHeader(name, value))
+		}
+	}
+
+	if cfg.Auth != "" {
+		user, _, _ := strings.Cut(cfg.Auth, ":")
+		cfgArr = append(cfgArr, "Basic auth "+user+":"+Redacted)
+	}
+
+	if cfg.Cookie != "" {
+		cfgArr = append(cfgArr, "Cookie "+Redacted)
+	}
+
+	if cfg.TLSVerify || cfg.CACert != "" {
+		cfgArr = append(cfgArr, "TLS certificates are verified")
+	}
+
+	if cfg.ClientCert != "" {
+		cfgArr = append(cfgArr, "TLS client certificate "+cfg.ClientCert)
+	}
+
+	if cfg.SNI != "" {
+		cfgArr = append(cfgArr, "TLS SNI "+cfg.SNI)
+	}
+
+	if cfg.CookieJar != "" {
+		cfgArr = append(cfgArr, fmt.Sprintf("Cookies from %s (%d)", cfg.CookieJar, len(cfg.JarCookies)))
+	}
+
+	if cfg.ProxyURL != nil {
+		cfgArr = append(cfgArr, "Proxy "+cfg.ProxyURL.Redacted())
+	}
+
+	if len(cfg.Resolve) > 0 {
+		cfgArr = append(cfgArr, "Resolve "+strings.Join(cfg.Resolve, ", "))
+	}
+
+	return
+}
+
+// parseProxy validates the --proxy value, empty value means proxy from HTTP(S)_PROXY and NO_PROXY.
+func parseProxy(proxy string) (proxyURL *url.URL, err error) {
+	if proxy == "" {
+		return
+	}
+
+	proxyURL, err = url.Parse(proxy)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", FlagProxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid --%s scheme '%s', use http, https, socks5 or socks5h", FlagProxy, proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid --%s, host is missing", FlagProxy)
+	}
+
+	return
+}
+
+// parseResolve adds --resolve entries in the curl format host:port:ip.
+func (cfg *Config) parseResolve() (err error) {
+	for _, entry := range cfg.Resolve {
+		parts := strings.SplitN(entry, ":", 3)
+
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid --%s '%s', use host:port:ip", FlagResolve, entry)
+		}
+
+		err = cfg.AddResolve(parts[0], parts[1], parts[2])
+
+		if err != nil {
+			return fmt.Errorf("invalid --%s '%s': %w", FlagResolve, entry, err)
+		}
+	}
+
+	return
+}
+
+// AddResolve connects to the IP instead of resolving the host, an empty port means both 80 and 443.
+// Host header and TLS SNI stay the same.
+func (cfg *Config) AddResolve(host string, port string, ip string) (err error) {
+	ip = strings.Trim(ip, "[]")
+
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP address '%s'", ip)
+	}
+
+	ports := []string{port}
+
+	if port == "" {
+		ports = []string{"80", "443"}
+	}
+
+	for _, p := range ports {
+		_, err = strconv.ParseUint(p, 10, 16)
+
+		if err != nil {
+			return fmt.Errorf("invalid port '%s'", p)
+		}
+
+		cfg.Resolved.AddKeyValue(ResolveKey(host, p), ip)
+	}
+
+	return
+}
+
+// AddResolveForUrl is AddResolve for a batch file line, the port defaults to the port in the URL.
+func (cfg *Config) AddResolveForUrl(urlP *url.URL, port string, ip string) (err error) {
+	if port == "" {
+		port = urlP.Port()
+	}
+
+	return cfg.AddResolve(urlP.Hostname(), port, ip)
+}
+
+func ResolveKey(host string, port string) string {
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// parseHeaders parses --header values in the curl format "Name: value".
+func parseHeaders(headers []string) (header http.Header, err error) {
+	header = http.Header{}
+
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --%s '%s', use \"Name: value\"", FlagHeader, h)
+		}
+
+		header.Add(name, strings.TrimSpace(value))
+	}
+
+	return
+}
+
+// RedactHeader hides values of headers carrying credentials.
+func RedactHeader(name string, value string) string {
+	lower := strings.ToLower(name)
+
+	for _, s := range []string{"auth", "cookie", "token", "key", "secret", "session"} {
+		if strings.Contains(lower, s) {
+			return Redacted
+		}
+	}
+
+	return value
+}
+
+// setWorkers applies defaults of --workers and --parallel-repos, they differ by the command.
+func (cfg *Config) setWorkers() (err error) {
+	if cfg.Workers < 0 || cfg.ParallelRepos < 0 {
+		return fmt.Errorf("--%s and --%s must be at least 1", FlagWorkers, FlagParallel)
+	}
+
+	if cfg.Workers == 0 {
+		cfg.Workers = DefaultFetchWorkers
+
+		if cfg.Command == CmdCheck {
+			cfg.Workers = DefaultCheckWorkers
+		}
+	}
+
+	if cfg.ParallelRepos == 0 {
+		cfg.ParallelRepos = DefaultParallelRepos
+	}
+
+	return
+}
+
+func checkPacing(rps float64, maxPerHost int) (err error) {
+	if rps < 0 {
+		err = fmt.Errorf("invalid --%s %g, use 0 for unlimited", FlagRps, rps)
+	} else if maxPerHost < 0 {
+		err = fmt.Errorf("invalid --%s %d, use 0 for unlimited", FlagPerHost, maxPerHost)
+	}
+
+	return
+}
+
+func checkFormat(format string) (err error) {
+	switch format {
+	case "", FormatText, FormatJson, FormatJsonl:
+	default:
+		err = fmt.Errorf("invalid --%s '%s', use %s, %s or %s", FlagFormat, format, FormatText, FormatJson, FormatJsonl)
+	}
+
+	return
+}
+
+// parseSize parses --max-*-size values, empty value or 0 means no limit.
+func parseSize(flag string, value string) (size int64, err error) {
+	if value == "" {
+		return
+	}
+
+	size, err = utils.HumanReadableToSize(value)
+
+	if err != nil {
+		err = fmt.Errorf("invalid --%s: %w", flag, err)
+	}
+
+	return
+}
+
+func sizeLimit(size int64) string {
+	if size <= 0 {
+		return "unlimited"
+	}
+
+	return utils.SizeToHumanReadable(size)
+}
+
+func checkRedirects(policy string) (err error) {
+	switch policy {
+	case "", RedirectFollow, RedirectSameHost, RedirectNever:
+	default:
+		err = fmt.Errorf("invalid --%s '%s', use %s, %s or %s", FlagRedirect, policy, RedirectFollow, RedirectSameHost, RedirectNever)
+	}
+
+	return
+}
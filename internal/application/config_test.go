@@ -0,0 +1,149 @@
+package application
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		entry    string
+		resolved map[string]string
+		isErr    bool
+	}{
+		{"unsecured.company:443:203.0.113.10", map[string]string{"unsecured.company:443": "203.0.113.10"}, false},
+		{"Unsecured.Company:8080:203.0.113.10", map[string]string{"unsecured.company:8080": "203.0.113.10"}, false},
+		{"unsecured.company:443:[2001:db8::1]", map[string]string{"unsecured.company:443": "2001:db8::1"}, false},
+		{"unsecured.company:443:2001:db8::1", map[string]string{"unsecured.company:443": "2001:db8::1"}, false},
+		{"unsecured.company:443", nil, true},
+		{":443:203.0.113.10", nil, true},
+		{"unsecured.company::203.0.113.10", nil, true},
+		{"unsecured.company:https:203.0.113.10", nil, true},
+		{"unsecured.company:70000:203.0.113.10", nil, true},
+		{"unsecured.company:443:203.0.113", nil, true},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Resolve: []string{tt.entry}, Resolved: utils.NewSafeMapStrings()}
+		err := cfg.parseResolve()
+
+		if tt.isErr {
+			assert.Error(t, err, tt.entry)
+			continue
+		}
+
+		assert.NoError(t, err, tt.entry)
+		assert.Equal(t, len(tt.resolved), cfg.Resolved.Count(), tt.entry)
+
+		for key, ip := range tt.resolved {
+			value, _ := cfg.Resolved.Get(key)
+			assert.Equal(t, ip, value, tt.entry)
+		}
+	}
+}
+
+func TestAddResolveForUrl(t *testing.T) {
+	tests := []struct {
+		url  string
+		port string
+		keys []string
+	}{
+		{"https://unsecured.company/", "", []string{"unsecured.company:80", "unsecured.company:443"}},
+		{"https://unsecured.company:8443/", "", []string{"unsecured.company:8443"}},
+		{"https://unsecured.company:8443/", "9443", []string{"unsecured.company:9443"}},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Resolved: utils.NewSafeMapStrings()}
+		urlP, _ := url.Parse(tt.url)
+
+		assert.NoError(t, cfg.AddResolveForUrl(urlP, tt.port, "203.0.113.10"))
+		assert.Equal(t, len(tt.keys), cfg.Resolved.Count(), tt.url)
+
+		for _, key := range tt.keys {
+			assert.True(t, cfg.Resolved.Exists(key), key)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		headers []string
+		header  http.Header
+		isErr   bool
+	}{
+		{nil, http.Header{}, false},
+		{[]string{"X-Api-Key: abc"}, http.Header{"X-Api-Key": {"abc"}}, false},
+		{[]string{"x-forwarded-for:127.0.0.1", "X-Forwarded-For: 10.0.0.1"}, http.Header{"X-Forwarded-For": {"127.0.0.1", "10.0.0.1"}}, false},
+		{[]string{"Referer: https://unsecured.company/a:b"}, http.Header{"Referer": {"https://unsecured.company/a:b"}}, false},
+		{[]string{"X-Empty:"}, http.Header{"X-Empty": {""}}, false},
+		{[]string{"X-Api-Key abc"}, nil, true},
+		{[]string{": abc"}, nil, true},
+		{[]string{"X Api: abc"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		header, err := parseHeaders(tt.headers)
+
+		if tt.isErr {
+			assert.Error(t, err, tt.headers)
+		} else {
+			assert.NoError(t, err, tt.headers)
+			assert.Equal(t, tt.header, header, tt.headers)
+		}
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		redacted bool
+	}{
+		{"Authorization", true},
+		{"Proxy-Authorization", true},
+		{"Cookie", true},
+		{"X-Auth-Token", true},
+		{"X-Api-Key", true},
+		{"X-Client-Secret", true},
+		{"X-Session-Id", true},
+		{"User-Agent", false},
+		{"X-Forwarded-For", false},
+		{"Host", false},
+	}
+
+	for _, tt := range tests {
+		value := RedactHeader(tt.name, "value")
+
+		assert.Equal(t, tt.redacted, value == Redacted, tt.name)
+	}
+}
+
+func TestPrintConfigurationTextNetwork(t *testing.T) {
+	tests := []struct {
+		command string
+		network bool
+	}{
+		{CmdCheck, true},
+		{CmdFetch, true},
+		{CmdCheckout, false},
+		{CmdIndex, false},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		out := NewOutput()
+		out.SetWriters(&stdout, &stderr)
+		cfg := &Config{Command: tt.command, Timeout: 10, StallTimeout: 30, UserAgent: "test"}
+
+		cfg.PrintConfigurationText(out)
+
+		assert.Equal(t, tt.network, strings.Contains(stderr.String(), "Stalled after 30 seconds"), tt.command)
+		assert.Equal(t, tt.network, strings.Contains(stderr.String(), "User Agent test"), tt.command)
+	}
+}
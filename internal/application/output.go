@@ -1,13 +1,23 @@
 package application
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sync"
 )
 
+// Output writes results to stdout and logs to stderr, so stdout stays valid JSON in json and jsonl format.
 type Output struct {
 	Verbose bool
+	Format  string
 	Files   *OutputFiles
+	mu      sync.Mutex
+	records []any
+	stdout  io.Writer
+	logger  *log.Logger
 }
 
 type OutputFiles struct {
@@ -26,7 +36,16 @@ func (f OutputFiles) Close() {
 }
 
 func NewOutput() (out *Output) {
-	return &Output{}
+	out = &Output{}
+	out.SetWriters(os.Stdout, os.Stderr)
+
+	return
+}
+
+// SetWriters redirects stdout and stderr, e.g. in tests.
+func (out *Output) SetWriters(stdout io.Writer, stderr io.Writer) {
+	out.stdout = stdout
+	out.logger = log.New(stderr, "", log.LstdFlags)
 }
 
 func NewOutputFiles(fileAbs string) (files *OutputFiles, err error) {
@@ -40,12 +59,65 @@ func NewOutputFiles(fileAbs string) (files *OutputFiles, err error) {
 	return
 }
 
+// Println writes to stdout, which is reserved for records in json and jsonl format.
 func (out *Output) Println(msg string) {
-	fmt.Println(msg)
+	if !out.IsStructured() {
+		_, _ = fmt.Fprintln(out.stdout, msg)
+	}
 }
 
 func (out *Output) Printf(msg string, v ...interface{}) {
-	fmt.Printf(msg, v...)
+	if !out.IsStructured() {
+		_, _ = fmt.Fprintf(out.stdout, msg, v...)
+	}
+}
+
+// Record prints one machine-readable result, it does nothing in text format.
+func (out *Output) Record(record any) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	switch out.Format {
+	case FormatJson:
+		out.records = append(out.records, record)
+	case FormatJsonl:
+		data, err := json.Marshal(record)
+
+		if err != nil {
+			out.log("encoding record: %v", err)
+			return
+		}
+
+		_, _ = fmt.Fprintln(out.stdout, string(data))
+	}
+}
+
+// Flush prints records collected in json format as a single array.
+func (out *Output) Flush() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.Format != FormatJson {
+		return
+	}
+
+	if out.records == nil {
+		out.records = []any{}
+	}
+
+	data, err := json.MarshalIndent(out.records, "", "  ")
+
+	if err != nil {
+		out.log("encoding records: %v", err)
+		return
+	}
+
+	_, _ = fmt.Fprintln(out.stdout, string(data))
+	out.records = nil
+}
+
+func (out *Output) IsStructured() bool {
+	return out.Format == FormatJson || out.Format == FormatJsonl
 }
 
 func (out *Output) Debug(msg string) {
@@ -78,6 +150,10 @@ func (out *Output) SetVerbose(verbose bool) {
 	out.Verbose = verbose
 }
 
+func (out *Output) SetFormat(format string) {
+	out.Format = format
+}
+
 func (out *Output) SetOutputDir(outDir string) (err error) {
 	out.Files, err = NewOutputFiles(outDir)
 
@@ -86,16 +162,16 @@ func (out *Output) SetOutputDir(outDir string) (err error) {
 
 func (out *Output) log(msg string, v ...interface{}) {
 	if len(v) == 0 {
-		log.Println(msg)
+		out.logger.Println(msg)
 	} else {
-		log.Printf(msg+"\n", v...)
+		out.logger.Printf(msg+"\n", v...)
 	}
 }
 
 func (out *Output) txt(msg string, v ...interface{}) {
 	if len(v) == 0 {
-		log.Println(msg)
+		out.logger.Println(msg)
 	} else {
-		log.Printf(msg+"\n", v...)
+		out.logger.Printf(msg+"\n", v...)
 	}
 }
@@ -0,0 +1,74 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	Url  string `json:"url"`
+	Code int    `json:"status_code"`
+}
+
+func TestOutputRecords(t *testing.T) {
+	records := []testRecord{{"https://unsecured.company/.git", 200}, {"https://unsecured.company:8443/.git", 404}}
+
+	tests := []struct {
+		format string
+		decode func(stdout string) []testRecord
+	}{
+		{FormatText, nil},
+		{FormatJson, func(stdout string) (decoded []testRecord) {
+			require.NoError(t, json.Unmarshal([]byte(stdout), &decoded))
+			return
+		}},
+		{FormatJsonl, func(stdout string) (decoded []testRecord) {
+			for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+				var record testRecord
+				require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+				decoded = append(decoded, record)
+			}
+			return
+		}},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		out := NewOutput()
+		out.SetWriters(&stdout, &stderr)
+		out.SetFormat(tt.format)
+
+		out.Log("starting")
+		out.Println("text result")
+
+		for _, record := range records {
+			out.Record(record)
+			out.Logf("checked %s", record.Url)
+		}
+
+		out.Flush()
+
+		assert.Contains(t, stderr.String(), "starting", tt.format)
+		assert.Contains(t, stderr.String(), "checked https://unsecured.company:8443/.git", tt.format)
+
+		if tt.decode == nil {
+			assert.Equal(t, "text result\n", stdout.String())
+			continue
+		}
+
+		assert.Equal(t, records, tt.decode(stdout.String()), tt.format)
+	}
+
+	// Empty json output is an array, not nothing.
+	var stdout bytes.Buffer
+	out := NewOutput()
+	out.SetWriters(&stdout, &bytes.Buffer{})
+	out.SetFormat(FormatJson)
+	out.Flush()
+	assert.JSONEq(t, "[]", stdout.String())
+}
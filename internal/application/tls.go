@@ -0,0 +1,85 @@
+package application
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// buildTLSConfig builds the client TLS config from the TLS flags.
+// Certificates are not verified unless --tls-verify or --ca-cert is set.
+func (cfg *Config) buildTLSConfig() (tlsConfig *tls.Config, err error) {
+	tlsConfig = &tls.Config{
+		InsecureSkipVerify: !cfg.TLSVerify && cfg.CACert == "",
+		ServerName:         cfg.SNI,
+	}
+
+	if cfg.TLSMinVersion != "" {
+		version, ok := tlsVersions[cfg.TLSMinVersion]
+
+		if !ok {
+			return nil, fmt.Errorf("invalid --%s '%s', use 1.0, 1.1, 1.2 or 1.3", FlagTLSMin, cfg.TLSMinVersion)
+		}
+
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CACert != "" {
+		tlsConfig.RootCAs, err = loadCertPool(cfg.CACert)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", FlagCACert, err)
+		}
+	}
+
+	if cfg.ClientKey != "" && cfg.ClientCert == "" {
+		return nil, fmt.Errorf("--%s requires --%s", FlagClientKey, FlagClientCert)
+	}
+
+	if cfg.ClientCert != "" {
+		keyFile := cfg.ClientKey
+
+		if keyFile == "" {
+			keyFile = cfg.ClientCert // PEM with both certificate and key
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, keyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", FlagClientCert, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return
+}
+
+// loadCertPool adds the PEM certificates to the system ones.
+func loadCertPool(path string) (pool *x509.CertPool, err error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	pool, err = x509.SystemCertPool()
+
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+
+	return pool, nil
+}
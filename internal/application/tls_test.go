@@ -0,0 +1,99 @@
+package application
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := createCertificate(t)
+	certFile := writeFile(t, dir, "cert.pem", certPEM)
+	keyFile := writeFile(t, dir, "key.pem", keyPEM)
+	bothFile := writeFile(t, dir, "both.pem", append(certPEM, keyPEM...))
+	emptyFile := writeFile(t, dir, "empty.pem", []byte("not a certificate"))
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		insecure   bool
+		minVersion uint16
+		rootCAs    bool
+		certs      int
+		isErr      bool
+	}{
+		{"defaults", Config{}, true, 0, false, 0, false},
+		{"verify", Config{TLSVerify: true, SNI: "unsecured.company"}, false, 0, false, 0, false},
+		{"min version", Config{TLSMinVersion: "1.2"}, true, tls.VersionTLS12, false, 0, false},
+		{"invalid min version", Config{TLSMinVersion: "1.4"}, false, 0, false, 0, true},
+		{"ca cert", Config{CACert: certFile}, false, 0, true, 0, false},
+		{"ca cert without certificates", Config{CACert: emptyFile}, false, 0, false, 0, true},
+		{"missing ca cert", Config{CACert: filepath.Join(dir, "missing.pem")}, false, 0, false, 0, true},
+		{"client cert and key", Config{ClientCert: certFile, ClientKey: keyFile}, true, 0, false, 1, false},
+		{"client cert with key in one file", Config{ClientCert: bothFile}, true, 0, false, 1, false},
+		{"client cert without key", Config{ClientCert: certFile}, false, 0, false, 0, true},
+		{"client key without cert", Config{ClientKey: keyFile}, false, 0, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.cfg.buildTLSConfig()
+
+			if tt.isErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.insecure, tlsConfig.InsecureSkipVerify)
+			assert.Equal(t, tt.cfg.SNI, tlsConfig.ServerName)
+			assert.Equal(t, tt.minVersion, tlsConfig.MinVersion)
+			assert.Equal(t, tt.rootCAs, tlsConfig.RootCAs != nil)
+			assert.Len(t, tlsConfig.Certificates, tt.certs)
+		})
+	}
+}
+
+// createCertificate returns a self-signed certificate and its key in PEM.
+func createCertificate(t *testing.T) (certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "unsecured.company"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) (path string) {
+	path = filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	return
+}
@@ -58,7 +58,7 @@ func (bat *Batch) analyzeFile() (err error) {
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
-		url := scanner.Text()
+		url, _, _ := utils.ParseBatchLine(scanner.Text())
 		parsedURL, err := utils.ParseUrlOrDomain(url)
 		isValid := err == nil && parsedURL.Host != ""
 		hasScheme := isValid && parsedURL.Scheme == ""
@@ -96,7 +96,7 @@ func (bat *Batch) readFile() (err error) {
 
 	scanner := bufio.NewScanner(file)
 
-	for scanner.Scan() {
+	for bat.app.Ctx.Err() == nil && scanner.Scan() {
 		line := scanner.Text()
 		err = bat.processLine(line)
 
@@ -114,13 +114,26 @@ func (bat *Batch) readFile() (err error) {
 }
 
 func (bat *Batch) processLine(line string) (err error) {
-	urls, err := utils.GetUrls(line)
+	urlStr, port, ip := utils.ParseBatchLine(line)
+	urls, err := utils.GetUrls(urlStr)
+
+	if err != nil {
+		return
+	}
+
+	for _, url := range urls {
+		if ip != "" {
+			err = bat.app.Cfg.AddResolveForUrl(url, port, ip)
 
-	if err == nil {
-		for _, url := range urls {
-			bat.UrlChan <- url
+			if err != nil {
+				return fmt.Errorf("invalid line [%s]: %w", line, err)
+			}
 		}
 	}
 
+	for _, url := range urls {
+		bat.UrlChan <- url
+	}
+
 	return
 }
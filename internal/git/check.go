@@ -2,8 +2,11 @@ package git
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/unsecured-company/gitrip/internal/application"
 	"github.com/unsecured-company/gitrip/internal/fs"
@@ -21,6 +24,8 @@ type Checker struct {
 	cntSuccess int
 	wgProcess  *sync.WaitGroup
 	batch      *fs.Batch
+	dedup      *Dedup
+	fetcher    *network.Fetcher // shared, so the per-host limits apply to all processors
 	cntYes     int
 	cntNo      int
 }
@@ -30,6 +35,8 @@ func NewChecker(app *application.App) (ch *Checker) {
 		app:       app,
 		wgProcess: &sync.WaitGroup{},
 		UrlChan:   make(chan *url.URL, UrlsChanSize),
+		dedup:     NewDedup(),
+		fetcher:   network.NewFetcher(app),
 	}
 
 	if app.Cfg.BatchFile != "" {
@@ -40,9 +47,9 @@ func NewChecker(app *application.App) (ch *Checker) {
 }
 
 func (ch *Checker) Run() (err error) {
-	ch.wgProcess.Add(application.DefaultCntDownThreads)
+	ch.wgProcess.Add(ch.app.Cfg.Workers)
 
-	for i := 0; i < application.DefaultCntDownThreads; i++ {
+	for i := 0; i < ch.app.Cfg.Workers; i++ {
 		go ch.processor()
 	}
 
@@ -55,6 +62,7 @@ func (ch *Checker) Run() (err error) {
 	}
 
 	ch.wgProcess.Wait()
+	ch.dedup.LogAliases(ch.app.Out)
 
 	return
 }
@@ -75,28 +83,62 @@ func (ch *Checker) runForUrl() (err error) {
 }
 
 func (ch *Checker) processor() {
-	fetcher := network.NewFetcher(ch.app)
-
 	for uri := range ch.UrlChan {
+		if ch.app.Ctx.Err() != nil {
+			continue // Drain the channel, so the producer is not blocked.
+		}
+
 		urlRoot := utils.GetNewSuffixedUrl(uri, PathRoot)
 
-		ch.check(fetcher, urlRoot)
+		ch.check(ch.fetcher, urlRoot)
 	}
 
 	ch.wgProcess.Done()
 }
 
+// CheckResult is the record for one checked URL in json and jsonl format.
+type CheckResult struct {
+	Url          string            `json:"url"`
+	FinalUrl     string            `json:"final_url"`
+	Redirects    []string          `json:"redirects,omitempty"`
+	AliasOf      string            `json:"alias_of,omitempty"`
+	Certificate  *network.CertInfo `json:"certificate,omitempty"`
+	StatusCode   int               `json:"status_code"`
+	Entries      int               `json:"index_entries"`
+	ObjectFormat string            `json:"object_format,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	DurationMs   int64             `json:"duration_ms"`
+}
+
 func (ch *Checker) check(fetcher *network.Fetcher, urlRoot *url.URL) {
+	started := time.Now()
+	res := &CheckResult{Url: urlRoot.String(), FinalUrl: urlRoot.String()}
+	defer func() {
+		res.DurationMs = time.Since(started).Milliseconds()
+		ch.app.Out.Record(res)
+	}()
+
 	urlIndex := utils.GetNewSuffixedUrl(urlRoot, PathIndex)
-	data, code, err := fetcher.Fetch(ch.app.Ctx, urlIndex.String(), 4)
+	data, code, info, err := fetcher.FetchWithInfo(ch.app.Ctx, urlIndex.String(), 4)
+	chain := info.Chain
+	res.StatusCode = code
+	res.Redirects = chain
+	res.Certificate = info.Certificate
+
+	if len(chain) > 0 {
+		res.FinalUrl, _ = rootFromIndexUrl(chain[len(chain)-1])
+		ch.app.Out.Logf("%s redirected to %s", urlIndex, chain[len(chain)-1])
+	}
 
 	if err != nil {
+		res.Error = err.Error()
 		ch.app.Out.Logf("%s failed, error: %v", urlIndex, err)
 
 		return
 	}
 
 	if code != 200 {
+		res.Error = fmt.Sprintf("status code %d", code)
 		ch.app.Out.Logf("%s failed, code: %d", urlIndex, code)
 
 		return
@@ -105,12 +147,43 @@ func (ch *Checker) check(fetcher *network.Fetcher, urlRoot *url.URL) {
 	index, err := NewIndexFromBytes(data)
 
 	if err != nil {
+		res.Error = err.Error()
 		ch.app.Out.Logf("%s failed for Index file, error: %v", urlIndex, err)
 
 		return
 	}
 
-	ch.app.Out.Println(urlRoot.String())
+	res.Entries = len(index.Entries)
+	res.ObjectFormat = index.Format.Name
+
+	if canonical, isAlias := ch.registerRepo(fetcher, res.FinalUrl, data); isAlias {
+		res.AliasOf = canonical
+		ch.app.Out.Logf("%s is the same repository as %s", res.FinalUrl, canonical)
+
+		return
+	}
+
+	ch.app.Out.Println(res.FinalUrl)
+
+	ch.app.Out.Logf("%s\tOK, files: %d", urlIndex, len(index.Entries))
+
+	if info.Certificate != nil {
+		ch.app.Out.Debugf("%s\tcertificate %s, names: %s", urlIndex, info.Certificate.Subject, strings.Join(info.Certificate.DNSNames, ", "))
+	}
+}
+
+func (ch *Checker) registerRepo(fetcher *network.Fetcher, root string, index []byte) (canonical string, isAlias bool) {
+	rootUrl, err := url.Parse(root)
+
+	if err != nil {
+		return
+	}
+
+	head, code, err := fetcher.Fetch(ch.app.Ctx, utils.GetNewSuffixedUrl(rootUrl, PathHead).String(), 4)
+
+	if err != nil || code != http.StatusOK {
+		head = nil
+	}
 
-	ch.app.Out.Logf("%s\tOK, files: %d", urlIndex, len(index.Index.Entries))
+	return ch.dedup.Register(rootUrl, index, head)
 }
@@ -0,0 +1,354 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unsecured-company/gitrip/internal/application"
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+const (
+	PermExecutable  = 0755
+	MaxRefRedirects = 10
+)
+
+// Checkout writes the working tree from a dumped .git directory, without a git binary.
+// Symlinks are written as regular files containing the link target, as git does with core.symlinks=false.
+type Checkout struct {
+	app       *application.App
+	out       *application.Output
+	gitDir    string
+	targetDir string
+	store     *ObjectStore
+	restored  map[string]bool
+	missing   map[string]string // path -> reason
+	badTrees  []string          // directories whose tree could not be read
+	indexAll  bool              // restore all index entries, not only those missing in the commit
+	cntBytes  int64
+}
+
+func RunCheckout(app *application.App) (err error) {
+	co, err := NewCheckout(app, app.Cfg.GitDir, app.Cfg.TargetDir)
+
+	if err != nil {
+		return
+	}
+
+	return co.Run(app.Cfg.Ref)
+}
+
+func NewCheckout(app *application.App, gitDir string, targetDir string) (co *Checkout, err error) {
+	gitDir, err = filepath.Abs(gitDir)
+
+	if err != nil {
+		return
+	}
+
+	if filepath.Base(gitDir) != PathRoot {
+		if info, errN := os.Stat(filepath.Join(gitDir, PathRoot)); errN == nil && info.IsDir() {
+			gitDir = filepath.Join(gitDir, PathRoot)
+		}
+	}
+
+	if targetDir == "" {
+		targetDir = filepath.Dir(gitDir)
+	}
+
+	targetDir, err = filepath.Abs(targetDir)
+
+	co = &Checkout{
+		app:       app,
+		out:       app.Out,
+		gitDir:    gitDir,
+		targetDir: targetDir,
+		restored:  make(map[string]bool),
+		missing:   make(map[string]string),
+	}
+
+	return
+}
+
+func (co *Checkout) Run(ref string) (err error) {
+	co.out.Logf("Checkout of [%s] from [%s] into [%s]", ref, co.gitDir, co.targetDir)
+	co.store, err = NewObjectStore(co.gitDir)
+	co.out.ErrorIf(err, "Reading packs")
+	defer co.store.Close()
+
+	commit, err := co.resolveRef(ref)
+
+	if err == nil {
+		err = co.writeCommit(commit)
+	}
+
+	// The index describes HEAD, it can not stand in for a ref the user asked for.
+	if err != nil && ref != PathHead {
+		return fmt.Errorf("can not use [%s]: %w", ref, err)
+	} else if err != nil {
+		co.out.Logf("Can not use [%s], only the index will be used: %v", ref, err)
+	}
+
+	// Index describes the working tree of HEAD, for other refs it only fills gaps.
+	co.indexAll = err != nil || ref == PathHead
+
+	co.restoreFromIndex()
+	co.report()
+
+	if len(co.restored) == 0 {
+		return errors.New("no files restored")
+	}
+
+	return nil
+}
+
+func (co *Checkout) writeCommit(commit string) (err error) {
+	_, content, err := co.objectOfType(commit, ObjectCommit)
+
+	if err != nil {
+		return
+	}
+
+	tree, err := commitTree(content)
+
+	if err != nil {
+		return fmt.Errorf("commit %s: %w", commit, err)
+	}
+
+	co.out.Logf("Commit %s, tree %s", commit, tree)
+	co.writeTree(tree, "")
+
+	return
+}
+
+func (co *Checkout) writeTree(hash string, dir string) {
+	_, content, err := co.objectOfType(hash, ObjectTree)
+
+	if err == nil {
+		var entries []TreeEntry
+		entries, err = parseTree(co.store.format, content)
+
+		for _, e := range entries {
+			co.writeTreeEntry(e, dir)
+		}
+	}
+
+	if err != nil {
+		co.badTrees = append(co.badTrees, dir)
+		co.out.Logf("Tree [%s/] %v", dir, err)
+	}
+}
+
+func (co *Checkout) writeTreeEntry(e TreeEntry, dir string) {
+	name := path.Join(dir, e.Name)
+
+	if !isSafePathPart(e.Name) {
+		co.missing[name] = "unsafe file name"
+		return
+	}
+
+	switch e.Mode {
+	case ModeTree:
+		co.writeTree(e.Hash, name)
+	case ModeGitlink:
+		err := os.MkdirAll(co.targetPath(name), DirPerm)
+		co.out.ErrorIf(err, "Submodule directory "+name)
+	default:
+		co.writeBlob(name, e.Hash, e.Mode)
+	}
+}
+
+func (co *Checkout) restoreFromIndex() {
+	idx, err := NewIndexFromFile(filepath.Join(co.gitDir, PathIndex))
+
+	if err != nil {
+		co.out.Logf("Index file can not be used: %v", err)
+		return
+	}
+
+	for _, e := range idx.Entries {
+		if co.restored[e.Name] || !co.isIndexFallback(e.Name) {
+			continue
+		}
+
+		if !isSafePath(e.Name) {
+			co.missing[e.Name] = "unsafe file name"
+			continue
+		}
+
+		co.writeBlob(e.Name, e.Hash, strconv.FormatUint(uint64(e.Mode), 8))
+	}
+}
+
+func (co *Checkout) isIndexFallback(name string) bool {
+	if _, isMissing := co.missing[name]; co.indexAll || isMissing {
+		return true
+	}
+
+	for _, dir := range co.badTrees {
+		if dir == "" || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (co *Checkout) writeBlob(name string, hash string, mode string) {
+	_, content, err := co.objectOfType(hash, ObjectBlob)
+
+	if err == nil {
+		perm := os.FileMode(FilePerm)
+
+		if mode == ModeExecutable {
+			perm = PermExecutable
+		}
+
+		file := co.targetPath(name)
+		err = os.MkdirAll(filepath.Dir(file), DirPerm)
+
+		if err == nil {
+			err = os.WriteFile(file, content, perm)
+		}
+	}
+
+	if err != nil {
+		co.missing[name] = err.Error()
+		return
+	}
+
+	co.restored[name] = true
+	co.cntBytes += int64(len(content))
+	delete(co.missing, name)
+}
+
+func (co *Checkout) objectOfType(hash string, expected string) (objType string, content []byte, err error) {
+	objType, content, err = co.store.Object(hash)
+
+	if err == nil && objType != expected {
+		err = fmt.Errorf("%s is %s, expected %s", hash, objType, expected)
+	}
+
+	return
+}
+
+// resolveRef resolves a ref name, HEAD or hash into a commit hash, annotated tags are peeled.
+func (co *Checkout) resolveRef(ref string) (hash string, err error) {
+	for i := 0; i < MaxRefRedirects; i++ {
+		if co.store.format.IsHash(ref) {
+			return co.peelToCommit(ref)
+		}
+
+		target, found := co.readRef(ref)
+
+		if !found {
+			return "", fmt.Errorf("ref [%s] not found", ref)
+		}
+
+		ref = strings.TrimSpace(strings.TrimPrefix(target, PrefixRef))
+	}
+
+	return "", fmt.Errorf("too many ref redirects")
+}
+
+func (co *Checkout) readRef(ref string) (target string, found bool) {
+	candidates := []string{ref}
+
+	if ref != PathHead && !strings.HasPrefix(ref, "refs/") {
+		candidates = append(candidates, "refs/"+ref, "refs/tags/"+ref, "refs/heads/"+ref, "refs/remotes/"+ref, "refs/remotes/"+ref+"/HEAD")
+	}
+
+	packed, _ := os.ReadFile(filepath.Join(co.gitDir, PathPacked))
+
+	for _, candidate := range candidates {
+		if candidate != PathHead && !isValidRefName(candidate) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(co.gitDir, filepath.FromSlash(candidate)))
+
+		if err == nil && len(data) > 0 {
+			return string(data), true
+		}
+
+		for _, line := range strings.Split(string(packed), "\n") {
+			parts := strings.Fields(line)
+
+			if len(parts) == 2 && parts[1] == candidate {
+				return parts[0], true
+			}
+		}
+	}
+
+	return
+}
+
+func (co *Checkout) peelToCommit(hash string) (commit string, err error) {
+	for i := 0; i < MaxRefRedirects; i++ {
+		objType, content, err := co.store.Object(hash)
+
+		if err != nil {
+			return "", err
+		}
+
+		if objType == ObjectCommit {
+			return hash, nil
+		}
+
+		if objType != ObjectTag {
+			return "", fmt.Errorf("%s is %s, not a commit", hash, objType)
+		}
+
+		tag, err := parseTag(content)
+
+		if err != nil {
+			return "", err
+		}
+
+		hash = tag.Object
+	}
+
+	return "", fmt.Errorf("too many nested tags")
+}
+
+func (co *Checkout) targetPath(name string) string {
+	return filepath.Join(co.targetDir, filepath.FromSlash(name))
+}
+
+func (co *Checkout) report() {
+	names := make([]string, 0, len(co.missing))
+
+	for name := range co.missing {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		co.out.Logf("Not restored [%s] %s", name, co.missing[name])
+	}
+
+	size := utils.SizeToHumanReadable(co.cntBytes)
+	co.out.Logf("Restored %d files (%s), %d could not be restored", len(co.restored), size, len(co.missing))
+}
+
+func isSafePath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if !isSafePathPart(part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isSafePathPart(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, "/\\\x00") &&
+		!strings.EqualFold(name, PathRoot)
+}
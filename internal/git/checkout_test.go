@@ -0,0 +1,93 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+func TestCheckoutFromLooseObjects(t *testing.T) {
+	gitDir := filepath.Join(t.TempDir(), PathRoot)
+	target := t.TempDir()
+
+	blob := writeLooseObject(t, gitDir, ObjectBlob, []byte("<?php echo 'secret';\n"))
+	missingBlob := "1e123d74161cd70f3bf678c2142034db220ada91"
+	subTree := writeLooseObject(t, gitDir, ObjectTree, treeContent(t, "100644 config.php", blob))
+	tree := writeLooseObject(t, gitDir, ObjectTree, treeContent(t,
+		"40000 app", subTree,
+		"100644 missing.txt", missingBlob,
+		"100644 ..", blob,
+	))
+	commit := writeLooseObject(t, gitDir, ObjectCommit, []byte("tree "+tree+"\n\nmessage\n"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, PathHead), []byte("ref: refs/heads/develop\n"), FilePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(gitDir, "refs/heads"), DirPerm))
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, "refs/heads/develop"), []byte(commit+"\n"), FilePerm))
+
+	app := &application.App{Out: application.NewOutput()}
+	co, err := NewCheckout(app, gitDir, target)
+	require.NoError(t, err)
+	require.NoError(t, co.Run(PathHead))
+
+	data, err := os.ReadFile(filepath.Join(target, "app", "config.php"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<?php echo 'secret';\n", string(data))
+	assert.Equal(t, map[string]bool{"app/config.php": true}, co.restored)
+	assert.Contains(t, co.missing, "missing.txt")
+	assert.Contains(t, co.missing, "..")
+}
+
+func TestCheckoutUnknownRef(t *testing.T) {
+	gitDir := filepath.Join(t.TempDir(), PathRoot)
+	writeLooseObject(t, gitDir, ObjectBlob, []byte("blob\n"))
+
+	app := &application.App{Out: application.NewOutput()}
+	co, err := NewCheckout(app, gitDir, t.TempDir())
+	require.NoError(t, err)
+	assert.ErrorContains(t, co.Run("release"), "ref [release] not found")
+}
+
+func TestObjectStoreCorruptLooseObjectFromPack(t *testing.T) {
+	gitDir := t.TempDir()
+	blob := []byte("packed copy\n")
+	hash := writeLooseObject(t, gitDir, ObjectBlob, blob)
+	path, _ := HashToPath(regexp.MustCompile(HashRegexp), hash)
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, path), []byte("truncated"), FilePerm))
+
+	store, err := NewObjectStore(gitDir)
+	require.NoError(t, err)
+	_, _, err = store.Object(hash)
+	assert.ErrorIs(t, err, ErrObjectCorrupt)
+
+	packData, _ := createPack([]packTestObject{{typ: packTypeBlob, data: blob}})
+	packFile := filepath.Join(gitDir, PathPrefixPack, "pack-45e49368a99785ecc6638838b6a969a6f40b3516"+SuffixPack)
+	require.NoError(t, os.MkdirAll(filepath.Dir(packFile), DirPerm))
+	require.NoError(t, os.WriteFile(packFile, packData, FilePerm))
+
+	store, err = NewObjectStore(gitDir)
+	require.NoError(t, err)
+	objType, content, err := store.Object(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, ObjectBlob, objType)
+	assert.Equal(t, blob, content)
+}
+
+func writeLooseObject(t *testing.T, gitDir string, objType string, content []byte) (hash string) {
+	hash = hashObject(FormatSHA1, objType, content)
+	path, err := HashToPath(regexp.MustCompile(HashRegexp), hash)
+	require.NoError(t, err)
+
+	file := filepath.Join(gitDir, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), DirPerm))
+
+	data := CompressGitObject([]byte(fmt.Sprintf("%s %d\x00%s", objType, len(content), content)))
+	require.NoError(t, os.WriteFile(file, data, FilePerm))
+
+	return
+}
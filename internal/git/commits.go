@@ -0,0 +1,114 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const FileCommits = ".gitrip-commits.jsonl"
+
+// CommitLog collects parsed commits of a repository, they are saved next to the .git directory.
+type CommitLog struct {
+	mu      sync.Mutex
+	commits map[string]*Commit
+}
+
+func NewCommitLog() *CommitLog {
+	return &CommitLog{commits: make(map[string]*Commit)}
+}
+
+func (cl *CommitLog) Add(commits []*Commit) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for _, commit := range commits {
+		cl.commits[commit.Hash] = commit
+	}
+}
+
+func (cl *CommitLog) Len() int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return len(cl.commits)
+}
+
+// Sorted returns commits from the newest by the committer time.
+func (cl *CommitLog) Sorted() (commits []*Commit) {
+	cl.mu.Lock()
+
+	for _, commit := range cl.commits {
+		commits = append(commits, commit)
+	}
+
+	cl.mu.Unlock()
+
+	sort.Slice(commits, func(i, j int) bool {
+		if !commits[i].Committer.When.Equal(commits[j].Committer.When) {
+			return commits[i].Committer.When.After(commits[j].Committer.When)
+		}
+
+		return commits[i].Hash < commits[j].Hash
+	})
+
+	return
+}
+
+// Save writes commits as json lines, commits already in the file from previous runs are kept.
+func (cl *CommitLog) Save(file string) (err error) {
+	if data, errR := os.ReadFile(file); errR == nil {
+		cl.load(data)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for _, commit := range cl.Sorted() {
+		if err = enc.Encode(commit); err != nil {
+			return
+		}
+	}
+
+	return os.WriteFile(file, buf.Bytes(), FilePerm)
+}
+
+func (cl *CommitLog) load(data []byte) {
+	var commits []*Commit
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+
+	for scanner.Scan() {
+		commit := &Commit{}
+
+		if json.Unmarshal(scanner.Bytes(), commit) == nil && commit.Hash != "" {
+			commits = append(commits, commit)
+		}
+	}
+
+	cl.Add(commits)
+}
+
+func (rp *Repo) commitsFile() string {
+	return filepath.Join(rp.metaDir, FileCommits)
+}
+
+func (rp *Repo) saveCommits() {
+	if rp.commits.Len() == 0 {
+		return
+	}
+
+	if err := rp.commits.Save(rp.commitsFile()); err != nil {
+		rp.logf("saving commits: %v", err)
+		return
+	}
+
+	sorted := rp.commits.Sorted()
+	newest, oldest := sorted[0].Committer.When, sorted[len(sorted)-1].Committer.When
+	rp.logf("%d commits from %s to %s saved into %s", len(sorted), oldest.Format(time.DateOnly), newest.Format(time.DateOnly), rp.commitsFile())
+}
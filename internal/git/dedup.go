@@ -0,0 +1,103 @@
+package git
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+const PrefixWww = "www."
+
+var ErrAlias = errors.New("same repository as")
+
+// Dedup recognises URL variants (http/https, www/non-www) serving the same repository.
+// The repository is identified by its index and HEAD, the first registered URL is canonical.
+type Dedup struct {
+	mu        sync.Mutex
+	canonical map[string]string   // variant key + fingerprint -> canonical root
+	aliases   map[string][]string // canonical root -> aliases
+}
+
+func NewDedup() *Dedup {
+	return &Dedup{
+		canonical: make(map[string]string),
+		aliases:   make(map[string][]string),
+	}
+}
+
+// Register returns the canonical root, isAlias is true when another variant was registered before.
+func (dd *Dedup) Register(root *url.URL, index []byte, head []byte) (canonical string, isAlias bool) {
+	key := variantKey(root) + " " + repoFingerprint(index, head)
+	rootStr := root.String()
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	canonical, isAlias = dd.canonical[key]
+
+	if !isAlias {
+		dd.canonical[key] = rootStr
+		return rootStr, false
+	}
+
+	if canonical == rootStr {
+		return canonical, false
+	}
+
+	dd.aliases[canonical] = append(dd.aliases[canonical], rootStr)
+
+	return
+}
+
+// Aliases returns canonical roots with their aliases, sorted.
+func (dd *Dedup) Aliases() (canonicals []string, aliases map[string][]string) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	aliases = make(map[string][]string, len(dd.aliases))
+
+	for canonical, list := range dd.aliases {
+		canonicals = append(canonicals, canonical)
+		aliases[canonical] = append([]string{}, list...)
+	}
+
+	sort.Strings(canonicals)
+
+	return
+}
+
+// LogAliases logs the skipped variants of each repository.
+func (dd *Dedup) LogAliases(out *application.Output) {
+	canonicals, aliases := dd.Aliases()
+
+	for _, canonical := range canonicals {
+		out.Logf("%s aliases: %s", canonical, strings.Join(aliases[canonical], ", "))
+	}
+}
+
+// variantKey is the same for URLs differing only in scheme, default port and www prefix.
+func variantKey(root *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(root.Hostname()), PrefixWww)
+	port := root.Port()
+
+	if port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	return host + strings.TrimRight(root.EscapedPath(), "/")
+}
+
+func repoFingerprint(index []byte, head []byte) string {
+	h := sha1.New()
+	h.Write(index)
+	h.Write([]byte{0})
+	h.Write(head)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupRegister(t *testing.T) {
+	index := []byte("DIRC\x00\x00\x00\x02")
+	head := []byte("ref: refs/heads/master\n")
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+
+	dd := NewDedup()
+
+	canonical, isAlias := dd.Register(parse("http://example.com/app/"), index, head)
+	assert.False(t, isAlias)
+	assert.Equal(t, "http://example.com/app/", canonical)
+
+	canonical, isAlias = dd.Register(parse("https://www.example.com:443/app"), index, head)
+	assert.True(t, isAlias)
+	assert.Equal(t, "http://example.com/app/", canonical)
+
+	_, isAlias = dd.Register(parse("https://example.com/other/"), index, head)
+	assert.False(t, isAlias)
+
+	_, isAlias = dd.Register(parse("https://example.com:8443/app/"), index, head)
+	assert.False(t, isAlias)
+
+	_, isAlias = dd.Register(parse("https://example.com/app/"), index, []byte("ref: refs/heads/main\n"))
+	assert.False(t, isAlias)
+
+	_, isAlias = dd.Register(parse("http://example.com/app/"), index, head)
+	assert.False(t, isAlias)
+
+	canonicals, aliases := dd.Aliases()
+	assert.Equal(t, []string{"http://example.com/app/"}, canonicals)
+	assert.Equal(t, []string{"https://www.example.com:443/app"}, aliases["http://example.com/app/"])
+}
@@ -7,7 +7,6 @@ import (
 	"math"
 	"net/url"
 	"os"
-	"regexp"
 	"sync"
 
 	"github.com/unsecured-company/gitrip/internal/application"
@@ -30,20 +29,24 @@ type Dumper struct {
 	cntFailed  int
 	cntSuccess int
 	domains    *utils.SafeMapStrings // TODO remove too, it will be chan
-	hashRegexp *regexp.Regexp
+	dedup      *Dedup
+	notFound   *NotFoundCache
+	scheduler  *Scheduler
 	wgSaver    *sync.WaitGroup
 	wgWorker   sync.WaitGroup
 }
 
 func NewDumper(app *application.App) *Dumper {
 	gf := Dumper{
-		app:        app,
-		fetcher:    network.NewFetcher(app),
-		chanSave:   make(chan *Item, ChanFetchSize),
-		domains:    utils.NewSafeMapStrings(),
-		hashRegexp: regexp.MustCompile(HashRegexp),
-		wgSaver:    &sync.WaitGroup{},
-		wgWorker:   sync.WaitGroup{},
+		app:       app,
+		fetcher:   network.NewFetcher(app),
+		chanSave:  make(chan *Item, ChanFetchSize),
+		domains:   utils.NewSafeMapStrings(),
+		dedup:     NewDedup(),
+		notFound:  NewNotFoundCache(),
+		scheduler: NewScheduler(app.Cfg.Workers),
+		wgSaver:   &sync.WaitGroup{},
+		wgWorker:  sync.WaitGroup{},
 	}
 
 	gf.wgSaver.Add(1)
@@ -54,6 +57,8 @@ func NewDumper(app *application.App) *Dumper {
 }
 
 func (d *Dumper) Run() (err error) {
+	defer d.Close()
+
 	if d.app.Cfg.URL != "" {
 		err = d.runForUrl(d.app.Cfg.URL)
 	} else if d.app.Cfg.BatchFile != "" {
@@ -62,6 +67,8 @@ func (d *Dumper) Run() (err error) {
 		err = errors.New("URL or BatchFile is required") // Should be caught by the config validation
 	}
 
+	d.dedup.LogAliases(d.app.Out)
+
 	return
 }
 
@@ -85,6 +92,8 @@ func (d *Dumper) runForUrl(urlStr string) (err error) {
 
 	rp := NewRepo(d, urlP)
 	err = rp.Run()
+	rp.wgSave.Wait()
+	d.app.Out.Record(rp.Result(err))
 
 	return
 }
@@ -96,8 +105,14 @@ func (d *Dumper) runnerSave() {
 		if err != nil {
 			d.app.Out.Logf(LogErrSavingFile, it.fileName, err)
 		}
+
+		if it.wgSave != nil {
+			it.wgSave.Done()
+		}
 	}
 
+	d.wgSaver.Done()
+
 	return
 }
 
@@ -111,9 +126,13 @@ func (d *Dumper) runForFile() (err error) {
 		return
 	}
 
-	d.wgWorker.Add(2)
-	go d.worker()
-	go d.worker()
+	d.app.Out.Debugf("Fetching %d repositories in parallel, %d workers", d.app.Cfg.ParallelRepos, d.app.Cfg.Workers)
+	d.wgWorker.Add(d.app.Cfg.ParallelRepos)
+
+	for i := 0; i < d.app.Cfg.ParallelRepos; i++ {
+		go d.worker()
+	}
+
 	d.wgWorker.Wait()
 
 	d.app.Out.Logf("Finished file [%s]", d.app.Cfg.BatchFile)
@@ -124,7 +143,7 @@ func (d *Dumper) runForFile() (err error) {
 func (d *Dumper) worker() {
 	var err error
 
-	for {
+	for d.app.Ctx.Err() == nil {
 		_, url := d.domains.PullRand()
 
 		if url == "" {
@@ -161,7 +180,12 @@ func (d *Dumper) readFile(filePath string) (err error) {
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		urlP, err := d.parseLine(line)
+		urlStr, port, ip := utils.ParseBatchLine(line)
+		urlP, err := d.parseLine(urlStr)
+
+		if err == nil && urlP.IsAbs() && ip != "" {
+			err = d.app.Cfg.AddResolveForUrl(urlP, port, ip)
+		}
 
 		if err == nil && urlP.IsAbs() {
 			d.cntSuccess++
@@ -1,43 +1,100 @@
 package git
 
 import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"os"
 	"sync"
 	"sync/atomic"
 )
 
-const todoChanSize = 10_000
 const doneMapSize = 1_000
 
+// Paths with lower priority are fetched first, refs and other small files reveal more paths.
+const (
+	priorityRefs        = iota
+	priorityInteresting // objects of files like .env, see interestingNames
+	priorityObject
+	priorityPack
+)
+
+// FetchQueue is an unbounded priority queue of paths, so adding never blocks fetching.
+// Completion is tracked by the work in progress: each path returned by Next and each Begin
+// must be followed by End. The queue is complete when nothing is queued and no work is in progress,
+// paths can be added only by the work in progress.
 type FetchQueue struct {
-	mu      sync.Mutex
-	todo    chan string
-	done    map[string]bool // value itself is not used, for now.
-	cntTodo atomic.Uint32
-	cntDone atomic.Uint32
+	ctx      context.Context
+	mu       sync.Mutex
+	cond     *sync.Cond
+	todo     pathHeap
+	seq      int
+	working  int
+	complete bool
+	done     map[string]bool // false while queued, true once fetched
+	cntTodo  atomic.Uint32
+	cntDone  atomic.Uint32
 }
 
-func NewFetchQueue() *FetchQueue {
-	return &FetchQueue{
-		mu:   sync.Mutex{},
-		todo: make(chan string, todoChanSize),
+// FetchQueueState is persisted into the dump directory when the fetch is interrupted.
+type FetchQueueState struct {
+	Todo []string `json:"todo"`
+	Done []string `json:"done"`
+}
+
+func NewFetchQueue(ctx context.Context) *FetchQueue {
+	fq := &FetchQueue{
+		ctx:  ctx,
 		done: make(map[string]bool, doneMapSize),
 	}
+
+	fq.cond = sync.NewCond(&fq.mu)
+
+	context.AfterFunc(ctx, func() {
+		fq.mu.Lock()
+		fq.cond.Broadcast()
+		fq.mu.Unlock()
+	})
+
+	return fq
 }
 
 func (fq *FetchQueue) Add(path string) {
+	fq.AddPriority(path, pathPriority(path))
+}
+
+// AddPriority queues the path with given priority, added is false for paths queued before.
+func (fq *FetchQueue) AddPriority(path string, priority int) (added bool) {
 	fq.mu.Lock()
-	_, isDone := fq.done[path]
+	defer fq.mu.Unlock()
 
-	if !isDone {
-		fq.done[path] = false
-		fq.cntTodo.Add(1)
+	if _, isQueued := fq.done[path]; isQueued {
+		return false
 	}
-	fq.mu.Unlock()
 
-	if !isDone {
-		// Add after unlock to avoid deadlock.
-		fq.todo <- path
+	fq.done[path] = false
+	fq.cntTodo.Add(1)
+	heap.Push(&fq.todo, queuedPath{path: path, priority: priority, seq: fq.seq})
+	fq.seq++
+	fq.cond.Broadcast() // Wait shares the condition, a signal could wake it instead of a fetcher.
+
+	return true
+}
+
+// AddDone records the path fetched outside of the queue, added is false for paths queued before.
+func (fq *FetchQueue) AddDone(path string) (added bool) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	if _, isQueued := fq.done[path]; isQueued {
+		return false
 	}
+
+	fq.done[path] = true
+	fq.cntTodo.Add(1)
+	fq.cntDone.Add(1)
+
+	return true
 }
 
 func (fq *FetchQueue) MarkDone(path string) {
@@ -47,16 +104,52 @@ func (fq *FetchQueue) MarkDone(path string) {
 	fq.mu.Unlock()
 }
 
-func (fq *FetchQueue) Todo() <-chan string {
-	return fq.todo
+// Next returns next path to fetch and starts its work, End must follow.
+// ok is false when the queue is complete or cancelled.
+func (fq *FetchQueue) Next() (path string, ok bool) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	for fq.todo.Len() == 0 && !fq.complete && fq.ctx.Err() == nil {
+		fq.cond.Wait()
+	}
+
+	if fq.todo.Len() == 0 || fq.ctx.Err() != nil {
+		return "", false
+	}
+
+	fq.working++
+
+	return heap.Pop(&fq.todo).(queuedPath).path, true
 }
 
-func (fq *FetchQueue) CountersEqual() (equals bool) {
+// Begin starts work which can add paths, e.g. processing of a fetched file.
+func (fq *FetchQueue) Begin() {
 	fq.mu.Lock()
-	equals = fq.cntTodo.Load() == fq.cntDone.Load()
+	fq.working++
 	fq.mu.Unlock()
+}
 
-	return
+func (fq *FetchQueue) End() {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	fq.working--
+
+	if fq.working == 0 && fq.todo.Len() == 0 {
+		fq.complete = true
+		fq.cond.Broadcast()
+	}
+}
+
+// Wait blocks until the queue is complete or cancelled.
+func (fq *FetchQueue) Wait() {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	for !fq.complete && fq.ctx.Err() == nil {
+		fq.cond.Wait()
+	}
 }
 
 func (fq *FetchQueue) CntDone() int {
@@ -67,6 +160,100 @@ func (fq *FetchQueue) CntQueued() int {
 	return int(fq.cntTodo.Load() - fq.cntDone.Load())
 }
 
-func (fq *FetchQueue) Close() {
-	close(fq.todo)
+// CntPending is the count of paths waiting for a fetcher.
+func (fq *FetchQueue) CntPending() int {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	return fq.todo.Len()
+}
+
+// SaveState stores paths in progress with the queued ones, they are fetched again by the next run.
+func (fq *FetchQueue) SaveState(file string) (err error) {
+	state := FetchQueueState{}
+	fq.mu.Lock()
+
+	for path, isDone := range fq.done {
+		if isDone {
+			state.Done = append(state.Done, path)
+		} else {
+			state.Todo = append(state.Todo, path)
+		}
+	}
+
+	fq.mu.Unlock()
+	data, err := json.Marshal(state)
+
+	if err == nil {
+		err = writeFileAtomic(file, data)
+	}
+
+	return
+}
+
+// LoadState marks previously fetched paths as done, so they are not requested again.
+// Returned todo paths are to be added back to the queue.
+func (fq *FetchQueue) LoadState(file string) (todo []string, err error) {
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return
+	}
+
+	state := FetchQueueState{}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return
+	}
+
+	fq.mu.Lock()
+
+	for _, path := range state.Done {
+		fq.done[path] = true
+	}
+
+	fq.mu.Unlock()
+
+	return state.Todo, nil
+}
+
+func pathPriority(path string) int {
+	switch {
+	case isPackFile(path, SuffixPack):
+		return priorityPack
+	case isObjectFile(path), isPackFile(path, SuffixPackIdx):
+		return priorityObject
+	default:
+		return priorityRefs
+	}
+}
+
+type queuedPath struct {
+	path     string
+	priority int
+	seq      int // keeps the order of paths with the same priority
+}
+
+type pathHeap []queuedPath
+
+func (h pathHeap) Len() int { return len(h) }
+
+func (h pathHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h pathHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pathHeap) Push(x any) { *h = append(*h, x.(queuedPath)) }
+
+func (h *pathHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return last
 }
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+func TestFetchQueueUnbounded(t *testing.T) {
+	fq := NewFetchQueue(context.Background())
+	fq.Begin()
+
+	for i := 0; i < 50_000; i++ {
+		fq.Add(fmt.Sprintf("objects/%02x/%038x", i%256, i))
+	}
+
+	fq.Add(PathHead)
+	fq.Add(PathHead)
+	fq.Add("objects/pack/pack-1.pack")
+	fq.Add("objects/pack/pack-1.idx")
+	fq.End()
+
+	path, ok := fq.Next()
+	assert.True(t, ok)
+	assert.Equal(t, PathHead, path)
+	fq.End()
+
+	path, _ = fq.Next()
+	assert.Equal(t, "objects/00/00000000000000000000000000000000000000", path)
+	fq.End()
+
+	cnt, last := 2, ""
+
+	for {
+		path, ok = fq.Next()
+
+		if !ok {
+			break
+		}
+
+		cnt++
+		last = path
+		fq.MarkDone(path)
+		fq.End()
+	}
+
+	assert.Equal(t, 50_003, cnt)
+	assert.Equal(t, "objects/pack/pack-1.pack", last)
+	assert.Equal(t, 50_001, fq.CntDone())
+	fq.Wait()
+}
+
+func TestFetchQueueCompletion(t *testing.T) {
+	fq := NewFetchQueue(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		fq.Wait()
+		close(done)
+	}()
+
+	fq.Begin()
+	fq.Add(PathHead)
+
+	path, ok := fq.Next()
+	assert.True(t, ok)
+	assert.Equal(t, PathHead, path)
+
+	fq.End() // Initial work, the fetched path is still in progress.
+	fq.Add("refs/heads/master")
+	fq.End()
+
+	select {
+	case <-done:
+		t.Fatal("queue completed with a queued path")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	path, _ = fq.Next()
+	assert.Equal(t, "refs/heads/master", path)
+	fq.End()
+	<-done
+
+	_, ok = fq.Next()
+	assert.False(t, ok)
+}
+
+func TestFetchQueueCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fq := NewFetchQueue(ctx)
+	fq.Begin()
+
+	go cancel()
+
+	_, ok := fq.Next()
+	assert.False(t, ok)
+	fq.Wait()
+}
+
+func TestFetchQueueWakesFetcher(t *testing.T) {
+	fq := NewFetchQueue(context.Background())
+	fq.Begin()
+
+	go fq.Wait()
+	time.Sleep(10 * time.Millisecond) // Wait is the first waiter of the condition.
+
+	paths := make(chan string)
+
+	go func() {
+		path, _ := fq.Next()
+		paths <- path
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	fq.Add(PathHead)
+
+	select {
+	case path := <-paths:
+		assert.Equal(t, PathHead, path)
+	case <-time.After(time.Second):
+		t.Fatal("fetcher was not woken by the added path")
+	}
+
+	fq.End()
+	fq.End()
+}
+
+func TestFetchQueueStateRoundTrip(t *testing.T) {
+	fq := NewFetchQueue(context.Background())
+	fq.Begin()
+
+	for _, path := range []string{PathHead, "refs/heads/main", "objects/ab/cdef", "objects/pack/pack-1.pack"} {
+		fq.Add(path)
+	}
+
+	// HEAD is done, refs/heads/main is in flight, its processing (Begin without End) is interrupted.
+	path, _ := fq.Next()
+	fq.MarkDone(path)
+	fq.End()
+	path, _ = fq.Next()
+	assert.Equal(t, "refs/heads/main", path)
+	fq.Begin()
+
+	file := filepath.Join(t.TempDir(), FileQueueState)
+	require.NoError(t, fq.SaveState(file))
+	_, err := os.Stat(file + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	app := &application.App{Cfg: &application.Config{}, Out: application.NewOutput(), Ctx: context.Background()}
+	urlP, _ := url.Parse("https://unsecured.company/.git")
+	rp := newRepo(&Dumper{app: app}, urlP)
+	rp.metaDir = filepath.Dir(file)
+	rp.loadState()
+
+	// Done paths are not queued again, also when they are found again.
+	rp.addPath(PathHead)
+	rp.FilesQueue.Begin()
+	rp.FilesQueue.End()
+	var fetched []string
+
+	for {
+		path, ok := rp.FilesQueue.Next()
+
+		if !ok {
+			break
+		}
+
+		fetched = append(fetched, path)
+		rp.FilesQueue.MarkDone(path)
+		rp.FilesQueue.End()
+	}
+
+	assert.ElementsMatch(t, []string{"refs/heads/main", "objects/ab/cdef", "objects/pack/pack-1.pack"}, fetched)
+}
+
+func TestFetchQueueStateCorrupt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), FileQueueState)
+	require.NoError(t, os.WriteFile(file, []byte(`{"todo":["HEAD"],"done":[`), FilePerm))
+
+	_, err := NewFetchQueue(context.Background()).LoadState(file)
+	assert.Error(t, err)
+}
@@ -2,34 +2,75 @@ package git
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 )
 
 const (
-	HashRegexp        = "[0-9a-f]{40}"
-	PathRoot          = ".git"
-	PathIndex         = "index"
-	PathHead          = "HEAD"
-	PrefixRef         = "ref: "
-	PrefixDIRC        = "DIRC"
-	PathPacks         = "objects/info/packs"
-	PathPacked        = "packed-refs"
-	PathInfoRefs      = "info/refs"
-	PathPrefixHooks   = "hooks/"
-	PathPrefixObjects = "objects/"
+	HashRegexp            = `\b[0-9a-f]{40}\b` // not a part of a longer hash
+	PathRoot              = ".git"
+	PathIndex             = "index"
+	PathPrefixSharedIndex = "sharedindex." // followed by the hash, referenced by the link extension of a split index
+	PathHead              = "HEAD"
+	PathOrigHead          = "ORIG_HEAD"
+	PathPrefixRefs        = "refs/"
+	PrefixRef             = "ref: "
+	PrefixDIRC            = "DIRC"
+	PathPacks             = "objects/info/packs"
+	PathPacked            = "packed-refs"
+	PathInfoRefs          = "info/refs"
+	PathPrefixHooks       = "hooks/"
+	PathPrefixObjects     = "objects/"
+	PathPrefixPack        = "objects/pack/"
+	PathPrefixInfo        = "objects/info/"
+	SuffixPack            = ".pack"
+	SuffixPackIdx         = ".idx"
 )
 
+// HashToPath converts the hash into the loose object path, hashRegexp is the Regexp of the repository ObjectFormat.
 func HashToPath(hashRegexp *regexp.Regexp, hash string) (path string, err error) {
 	hash = strings.TrimSpace(hash)
 
-	if len(hash) != 40 || hashRegexp.Match([]byte(hash)) == false {
+	if hashRegexp.FindString(hash) != hash || hash == "" {
 		return hash, fmt.Errorf("Invalid hash <%s>", hash)
 	}
 
 	return fmt.Sprintf("objects/%s/%s", hash[:2], hash[2:]), nil
 }
 
+// rootFromIndexUrl returns the repository root of index URL, ok is false for other URLs, e.g. a login page.
+func rootFromIndexUrl(urlStr string) (root string, ok bool) {
+	root, ok = strings.CutSuffix(urlStr, "/"+PathIndex)
+
+	if !ok {
+		return urlStr, false
+	}
+
+	return
+}
+
+func isObjectFile(name string) bool {
+	return strings.HasPrefix(name, PathPrefixObjects) &&
+		!strings.HasPrefix(name, PathPrefixPack) &&
+		!strings.HasPrefix(name, PathPrefixInfo)
+}
+
+// hashFromObjectPath converts "objects/XX/YYY.." into the object hash.
+func hashFromObjectPath(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(path, PathPrefixObjects), "/", "")
+}
+
+func isPackFile(name string, suffix string) bool {
+	return strings.HasPrefix(name, PathPrefixPack) && strings.HasSuffix(name, suffix)
+}
+
+func isSharedIndexFile(name string) bool {
+	hash, ok := strings.CutPrefix(name, PathPrefixSharedIndex)
+
+	return ok && isHash(hash)
+}
+
 func getPathsCommon() (paths map[string]bool) {
 	paths = make(map[string]bool)
 
@@ -38,28 +79,16 @@ func getPathsCommon() (paths map[string]bool) {
 		PathPacks,
 		PathPacked,
 		PathInfoRefs,
-		"FETCH_HEAD",
+		PathFetchHead,
 		"logs/stash",
 		"logs/HEAD",
-		"logs/refs/heads/master",
-		"logs/refs/heads/main",
-		"logs/refs/heads/origin",
-		"logs/refs/remotes/origin/HEAD",
-		"logs/refs/remotes/origin/master",
-		"logs/refs/remotes/origin/main",
-		"packed-refs",
-		"refs/heads/master",
-		"refs/heads/main",
-		"refs/heads/origin",
-		"refs/remotes/origin/master",
-		"refs/remotes/origin/main",
-		"refs/remotes/origin/HEAD",
-
-		"ORIG_HEAD",
+		"refs/stash",
+
+		PathOrigHead,
 		"application",
 		"description",
 		"COMMIT_EDITMSG",
-		"config",
+		PathConfig,
 		"info/exclude",
 
 		"hooks/applypatch-msg",
@@ -102,3 +131,19 @@ func getPathsCommon() (paths map[string]bool) {
 
 	return
 }
+
+// writeFileAtomic replaces the file only when all data are written, an interrupted write leaves the previous file.
+func writeFileAtomic(file string, data []byte) (err error) {
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, data, FilePerm)
+
+	if err == nil {
+		err = os.Rename(tmpFile, file)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpFile)
+	}
+
+	return
+}
@@ -1,21 +1,53 @@
 package git
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 
-	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/unsecured-company/gitrip/internal/application"
 	"github.com/unsecured-company/gitrip/internal/utils"
 )
 
+// Index is a decoded .git/index file, versions 2 to 4 in both object formats.
 type Index struct {
-	Index *index.Index
+	Version     uint32
+	Format      *ObjectFormat
+	Entries     []*IndexEntry
+	Cache       []*IndexTree        // directories with their tree objects
+	ResolveUndo []*IndexResolveUndo // blobs of resolved conflicts
+	Link        *IndexLink          // set for a split index
 }
 
+type IndexEntry struct {
+	Name       string
+	Hash       string
+	Mode       filemode.FileMode
+	Size       uint32
+	Stage      int
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Dev        uint32
+	Inode      uint32
+	UID        uint32
+	GID        uint32
+}
+
+// IndexEntryRecord is the record for one index entry in json and jsonl format.
+type IndexEntryRecord struct {
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	Size       uint32    `json:"size"`
+	Mode       string    `json:"mode"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Recovery   string    `json:"recovery,omitempty"`
+}
+
+// NewIndexFromFile reads the index, entries of a split index are merged with its shared index from the same directory.
 func NewIndexFromFile(indexPath string) (idx *Index, err error) {
 	file, err := os.Open(indexPath)
 
@@ -26,23 +58,31 @@ func NewIndexFromFile(indexPath string) (idx *Index, err error) {
 	idx, err = NewIndexFromReader(file)
 	file.Close()
 
-	return
+	if err != nil || !idx.HasSharedIndex() {
+		return
+	}
+
+	shared, err := NewIndexFromFile(filepath.Join(filepath.Dir(indexPath), PathPrefixSharedIndex+idx.Link.SharedIndex))
+
+	if err != nil {
+		return nil, fmt.Errorf("shared index: %w", err)
+	}
+
+	return idx, idx.mergeShared(shared)
 }
 
 func NewIndexFromReader(fr io.Reader) (idx *Index, err error) {
-	idx = &Index{
-		Index: &index.Index{},
-	}
+	data, err := io.ReadAll(fr)
 
-	err = index.NewDecoder(fr).Decode(idx.Index)
+	if err != nil {
+		return
+	}
 
-	return idx, err
+	return NewIndexFromBytes(data)
 }
 
 func NewIndexFromBytes(data []byte) (idx *Index, err error) {
-	fr := io.Reader(bytes.NewReader(data))
-
-	return NewIndexFromReader(fr)
+	return decodeIndex(data)
 }
 
 func RunIndexDump(app *application.App) (err error) {
@@ -54,27 +94,45 @@ func RunIndexDump(app *application.App) (err error) {
 
 	header := fmt.Sprintf("Index file '%s'", app.Cfg.IndexFile)
 	var tree string
+	var rec *Recovery
+
+	if app.Cfg.Recovery {
+		var store *ObjectStore
+		store, err = NewObjectStore(filepath.Dir(app.Cfg.IndexFile))
+		app.Out.ErrorIf(err, "Reading packs")
+		rec = NewRecovery(idx, store)
+		store.Close()
+	}
 
 	if app.Cfg.Tree {
 		header += " - TREE view"
 		tree = utils.GetTreeAsString(idx.getFiles())
 	} else if app.Cfg.Raw {
 		header += " - RAW view"
-		tree = idx.Index.String()
+		tree = idx.String()
 	} else if app.Cfg.Csv {
 		header += " - CSV view"
-		tree += idx.getAsCsv()
+		tree += idx.getAsCsv(rec)
 	} else {
 		header += " - PATHS only"
-		for _, ent := range idx.Index.Entries {
+		for _, ent := range idx.Entries {
+			if rec != nil {
+				tree += rec.Statuses[ent.Name] + "\t"
+			}
+
 			tree += ent.Name + "\n"
 		}
 	}
 
 	app.Out.Log(header)
 	app.Out.Println(tree)
+	idx.record(app.Out, rec)
 
-	return
+	if rec != nil {
+		app.Out.Logf("Recovery: %s", rec.Summary())
+	}
+
+	return nil
 }
 
 func showAsTree(app *application.App) (err error) {
@@ -103,7 +161,7 @@ func showAsTree(app *application.App) (err error) {
 	var tree string
 
 	if !app.Cfg.Tree && !app.Cfg.Raw && !app.Cfg.Csv {
-		tree += idx.getAsCsv()
+		tree += idx.getAsCsv(nil)
 	}
 
 	if app.Cfg.Tree {
@@ -124,10 +182,16 @@ func showAsTree(app *application.App) (err error) {
 	return
 }
 
-func (idx *Index) getAsCsv() (str string) {
-	str = "name;hash;size;created_at;modified_at\n"
+func (idx *Index) getAsCsv(rec *Recovery) (str string) {
+	str = "name;hash;size;created_at;modified_at"
+
+	if rec != nil {
+		str += ";recovered"
+	}
+
+	str += "\n"
 
-	for _, e := range idx.Index.Entries {
+	for _, e := range idx.Entries {
 		var modifiedAt string
 		createdAt := e.CreatedAt.Format(time.DateTime)
 		size := utils.SizeToHumanReadable(int64(e.Size))
@@ -136,14 +200,43 @@ func (idx *Index) getAsCsv() (str string) {
 			modifiedAt = e.ModifiedAt.Format(time.DateTime)
 		}
 
-		str += fmt.Sprintf("%s;%s;%s;%s;%s\n", e.Name, e.Hash.String(), size, createdAt, modifiedAt)
+		str += fmt.Sprintf("%s;%s;%s;%s;%s", e.Name, e.Hash, size, createdAt, modifiedAt)
+
+		if rec != nil {
+			str += ";" + rec.Statuses[e.Name]
+		}
+
+		str += "\n"
 	}
 
 	return
 }
 
+func (idx *Index) record(out *application.Output, rec *Recovery) {
+	if !out.IsStructured() {
+		return
+	}
+
+	for _, e := range idx.Entries {
+		record := &IndexEntryRecord{
+			Name:       e.Name,
+			Hash:       e.Hash,
+			Size:       e.Size,
+			Mode:       e.Mode.String(),
+			CreatedAt:  e.CreatedAt,
+			ModifiedAt: e.ModifiedAt,
+		}
+
+		if rec != nil {
+			record.Recovery = rec.Statuses[e.Name]
+		}
+
+		out.Record(record)
+	}
+}
+
 func (idx *Index) getAsTree() (str string) {
-	for _, e := range idx.Index.Entries {
+	for _, e := range idx.Entries {
 		size := utils.SizeToHumanReadable(int64(e.Size))
 		str += size + "\t" + e.Name + "\n"
 	}
@@ -152,7 +245,7 @@ func (idx *Index) getAsTree() (str string) {
 }
 
 func (idx *Index) getAsPaths() (str string) {
-	for _, ent := range idx.Index.Entries {
+	for _, ent := range idx.Entries {
 		str += ent.Name + "\n"
 	}
 
@@ -160,13 +253,13 @@ func (idx *Index) getAsPaths() (str string) {
 }
 
 func (idx *Index) getAsRaw() (str string) {
-	return idx.Index.String()
+	return idx.String()
 }
 
 func (idx *Index) getFiles() (paths []string) {
 	paths = make([]string, 0)
 
-	for _, e := range idx.Index.Entries {
+	for _, e := range idx.Entries {
 		paths = append(paths, e.Name)
 	}
 
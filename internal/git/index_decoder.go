@@ -0,0 +1,249 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+const (
+	indexHeaderSize    = 12
+	indexEntryStatSize = 40 // ctime, mtime, dev, ino, mode, uid, gid and size, 4 bytes each
+	indexNameMask      = 0xfff
+	indexFlagExtended  = 0x4000
+	indexVersionMin    = 2
+	indexVersionMax    = 4
+	indexExtHeaderSize = 8
+)
+
+var (
+	ErrIndexChecksum  = errors.New("index checksum does not match its content, or unknown object format")
+	ErrIndexTruncated = errors.New("index is truncated")
+)
+
+// decodeIndex reads the index in its own object format, which is recognised by the checksum at its end.
+// go-git decodes only the format it was built for, so sha256 repositories need this decoder.
+// With index.skipHash the checksum is all zeros, the format is then the one in which the entries decode.
+func decodeIndex(data []byte) (idx *Index, err error) {
+	if !bytes.HasPrefix(data, []byte(PrefixDIRC)) || len(data) < indexHeaderSize {
+		return nil, fmt.Errorf("index does not start with %s", PrefixDIRC)
+	}
+
+	if version := binary.BigEndian.Uint32(data[4:8]); version < indexVersionMin || version > indexVersionMax {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+
+	if format := formatFromChecksum(data); format != nil {
+		return decodeIndexFormat(data, format)
+	}
+
+	for _, format := range []*ObjectFormat{FormatSHA1, FormatSHA256} {
+		if !hasZeroChecksum(data, format.Size) {
+			continue
+		}
+
+		if idx, err = decodeIndexFormat(data, format); err == nil {
+			return
+		}
+	}
+
+	return nil, ErrIndexChecksum
+}
+
+func decodeIndexFormat(data []byte, format *ObjectFormat) (idx *Index, err error) {
+	idx = &Index{
+		Version: binary.BigEndian.Uint32(data[4:8]),
+		Format:  format,
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	data = data[:len(data)-idx.Format.Size]
+	pos := indexHeaderSize
+	var prev string
+
+	for i := 0; i < count; i++ {
+		var e *IndexEntry
+
+		if e, pos, err = idx.decodeEntry(data, pos, prev); err != nil {
+			return nil, fmt.Errorf("index entry %d/%d: %w", i+1, count, err)
+		}
+
+		idx.Entries = append(idx.Entries, e)
+		prev = e.Name
+	}
+
+	if err = idx.decodeExtensions(data[pos:]); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func hasZeroChecksum(data []byte, size int) bool {
+	return len(data) >= indexHeaderSize+size && bytes.Count(data[len(data)-size:], []byte{0}) == size
+}
+
+// indexFormat is the object format of the index, also of one written with index.skipHash.
+func indexFormat(data []byte) *ObjectFormat {
+	if format := formatFromChecksum(data); format != nil {
+		return format
+	}
+
+	if idx, err := decodeIndex(data); err == nil {
+		return idx.Format
+	}
+
+	return nil
+}
+
+func (idx *Index) decodeEntry(data []byte, pos int, prev string) (e *IndexEntry, next int, err error) {
+	hashEnd := pos + indexEntryStatSize + idx.Format.Size
+
+	if len(data) < hashEnd+2 {
+		return nil, pos, ErrIndexTruncated
+	}
+
+	stat := func(i int) uint32 { return binary.BigEndian.Uint32(data[pos+i*4:]) }
+	flags := binary.BigEndian.Uint16(data[hashEnd:])
+
+	e = &IndexEntry{
+		CreatedAt:  indexTime(stat(0), stat(1)),
+		ModifiedAt: indexTime(stat(2), stat(3)),
+		Dev:        stat(4),
+		Inode:      stat(5),
+		Mode:       filemode.FileMode(stat(6)),
+		UID:        stat(7),
+		GID:        stat(8),
+		Size:       stat(9),
+		Hash:       hex.EncodeToString(data[pos+indexEntryStatSize : hashEnd]),
+		Stage:      int(flags>>12) & 0x3,
+	}
+
+	next = hashEnd + 2
+
+	if flags&indexFlagExtended != 0 {
+		next += 2
+	}
+
+	if next > len(data) {
+		return nil, pos, ErrIndexTruncated
+	}
+
+	if idx.Version == 4 {
+		e.Name, next, err = decodeEntryNameV4(data, next, prev)
+		return
+	}
+
+	nameLen := int(flags & indexNameMask)
+
+	// Longer names have the mask value and end with NUL.
+	if nameLen == indexNameMask {
+		nameLen = bytes.IndexByte(data[next:], 0)
+	}
+
+	if nameLen < 0 || next+nameLen > len(data) {
+		return nil, pos, ErrIndexTruncated
+	}
+
+	e.Name = string(data[next : next+nameLen])
+	// Entries are padded with 1 to 8 NUL bytes to a multiple of 8.
+	next = pos + (next-pos+nameLen+8)&^7
+
+	return
+}
+
+// decodeEntryNameV4 reads the name compressed against the previous one: how many bytes to strip and the NUL terminated suffix.
+func decodeEntryNameV4(data []byte, pos int, prev string) (name string, next int, err error) {
+	strip, pos, err := readOffsetVarint(data, pos)
+
+	if err != nil {
+		return
+	}
+
+	if strip > len(prev) {
+		return "", pos, fmt.Errorf("name strips %d bytes of %d", strip, len(prev))
+	}
+
+	end := bytes.IndexByte(data[pos:], 0)
+
+	if end < 0 {
+		return "", pos, ErrIndexTruncated
+	}
+
+	return prev[:len(prev)-strip] + string(data[pos:pos+end]), pos + end + 1, nil
+}
+
+// readOffsetVarint reads the variable length integer used by pack offsets and index v4.
+func readOffsetVarint(data []byte, pos int) (value int, next int, err error) {
+	for i := 0; ; i++ {
+		if pos >= len(data) || i > 8 {
+			return 0, pos, ErrIndexTruncated
+		}
+
+		c := data[pos]
+		pos++
+
+		if i > 0 {
+			value++
+		}
+
+		value = value<<7 | int(c&0x7f)
+
+		if c&0x80 == 0 {
+			return value, pos, nil
+		}
+	}
+}
+
+// decodeExtensions reads extensions between entries and the checksum, unknown optional ones start with upper case letter.
+func (idx *Index) decodeExtensions(data []byte) (err error) {
+	for len(data) >= indexExtHeaderSize {
+		signature := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+
+		if len(data) < indexExtHeaderSize+size {
+			return fmt.Errorf("index extension %q: %w", signature, ErrIndexTruncated)
+		}
+
+		if err = idx.decodeExtension(signature, data[indexExtHeaderSize:indexExtHeaderSize+size]); err != nil {
+			return
+		}
+
+		data = data[indexExtHeaderSize+size:]
+	}
+
+	if len(data) > 0 {
+		return fmt.Errorf("%d bytes after index extensions", len(data))
+	}
+
+	return
+}
+
+func indexTime(sec uint32, nsec uint32) (t time.Time) {
+	if sec != 0 || nsec != 0 {
+		t = time.Unix(int64(sec), int64(nsec))
+	}
+
+	return
+}
+
+// String lists entries in the raw view of the index command.
+func (idx *Index) String() string {
+	var buf bytes.Buffer
+
+	for _, e := range idx.Entries {
+		fmt.Fprintf(&buf, "%06o %s %d\t%s\n", e.Mode, e.Hash, e.Stage, e.Name)
+		fmt.Fprintf(&buf, "  ctime: %d:%d\n", e.CreatedAt.Unix(), e.CreatedAt.Nanosecond())
+		fmt.Fprintf(&buf, "  mtime: %d:%d\n", e.ModifiedAt.Unix(), e.ModifiedAt.Nanosecond())
+		fmt.Fprintf(&buf, "  dev: %d\tino: %d\n", e.Dev, e.Inode)
+		fmt.Fprintf(&buf, "  uid: %d\tgid: %d\n", e.UID, e.GID)
+		fmt.Fprintf(&buf, "  size: %d\tflags: %x\n", e.Size, 0)
+	}
+
+	return buf.String()
+}
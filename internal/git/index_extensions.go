@@ -0,0 +1,297 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+const (
+	indexExtTree        = "TREE"
+	indexExtResolveUndo = "REUC"
+	indexExtLink        = "link"
+	indexExtSparse      = "sdir"
+	ewahHeaderSize      = 8
+	ewahWordBits        = 64
+)
+
+// IndexTree is a directory of the cache tree extension, Hash is empty for directories changed since the tree was written.
+type IndexTree struct {
+	Path     string
+	Entries  int
+	Subtrees int
+	Hash     string
+}
+
+// IndexResolveUndo keeps blobs of a resolved merge conflict.
+type IndexResolveUndo struct {
+	Path   string
+	Hashes []string // base, ours and theirs, missing stages are skipped
+}
+
+// IndexLink points the split index to entries in sharedindex.<hash>, positions are entries of the shared index.
+type IndexLink struct {
+	SharedIndex string
+	Delete      []int
+	Replace     []int
+}
+
+func (idx *Index) decodeExtension(signature string, data []byte) (err error) {
+	switch signature {
+	case indexExtTree:
+		for len(data) > 0 && err == nil {
+			data, err = idx.decodeTree(data, "")
+		}
+	case indexExtResolveUndo:
+		err = idx.decodeResolveUndo(data)
+	case indexExtLink:
+		err = idx.decodeLink(data)
+	case indexExtSparse:
+		// No data, entries with the directory mode are trees.
+	default:
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			err = fmt.Errorf("unsupported index extension %q", signature)
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("index extension %q: %w", signature, err)
+	}
+
+	return
+}
+
+// decodeTree reads a directory "<name>\0<entries> <subtrees>\n<hash>" followed by its subdirectories.
+func (idx *Index) decodeTree(data []byte, parent string) (rest []byte, err error) {
+	name, rest, found := bytes.Cut(data, []byte{0})
+	counts, rest, found2 := bytes.Cut(rest, []byte{'\n'})
+	entries, subtrees, found3 := strings.Cut(string(counts), " ")
+
+	if !found || !found2 || !found3 {
+		return nil, ErrIndexTruncated
+	}
+
+	tree := &IndexTree{Path: path.Join(parent, string(name))}
+
+	if tree.Entries, err = strconv.Atoi(entries); err != nil {
+		return
+	}
+
+	if tree.Subtrees, err = strconv.Atoi(subtrees); err != nil {
+		return
+	}
+
+	// Invalidated directories have -1 entries and no hash.
+	if tree.Entries >= 0 {
+		if len(rest) < idx.Format.Size {
+			return nil, ErrIndexTruncated
+		}
+
+		tree.Hash = hex.EncodeToString(rest[:idx.Format.Size])
+		rest = rest[idx.Format.Size:]
+	}
+
+	idx.Cache = append(idx.Cache, tree)
+
+	for i := 0; i < tree.Subtrees && err == nil; i++ {
+		rest, err = idx.decodeTree(rest, tree.Path)
+	}
+
+	return
+}
+
+// decodeResolveUndo reads "<path>\0<mode>\0<mode>\0<mode>\0" followed by hashes of stages with non-zero mode.
+func (idx *Index) decodeResolveUndo(data []byte) (err error) {
+	for len(data) > 0 {
+		parts := bytes.SplitN(data, []byte{0}, 5)
+
+		if len(parts) < 5 {
+			return ErrIndexTruncated
+		}
+
+		reuc := &IndexResolveUndo{Path: string(parts[0])}
+		data = parts[4]
+
+		for _, mode := range parts[1:4] {
+			if m, errM := strconv.ParseUint(string(mode), 8, 32); errM != nil {
+				return fmt.Errorf("invalid mode %q of %s", mode, reuc.Path)
+			} else if m == 0 {
+				continue
+			}
+
+			if len(data) < idx.Format.Size {
+				return ErrIndexTruncated
+			}
+
+			reuc.Hashes = append(reuc.Hashes, hex.EncodeToString(data[:idx.Format.Size]))
+			data = data[idx.Format.Size:]
+		}
+
+		idx.ResolveUndo = append(idx.ResolveUndo, reuc)
+	}
+
+	return
+}
+
+// decodeLink reads the hash of the shared index and optional delete and replace bitmaps.
+func (idx *Index) decodeLink(data []byte) (err error) {
+	if len(data) < idx.Format.Size {
+		return ErrIndexTruncated
+	}
+
+	idx.Link = &IndexLink{SharedIndex: hex.EncodeToString(data[:idx.Format.Size])}
+	data = data[idx.Format.Size:]
+
+	if len(data) == 0 {
+		return
+	}
+
+	if idx.Link.Delete, data, err = decodeEwah(data); err == nil {
+		idx.Link.Replace, _, err = decodeEwah(data)
+	}
+
+	return
+}
+
+// decodeEwah returns positions of set bits of the EWAH compressed bitmap: bit count, word count,
+// words and the position of the last run length word. Each run length word is followed by literal words.
+func decodeEwah(data []byte) (bits []int, rest []byte, err error) {
+	if len(data) < ewahHeaderSize {
+		return nil, nil, ErrIndexTruncated
+	}
+
+	size := int(binary.BigEndian.Uint32(data))
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	end := ewahHeaderSize + count*8 + 4
+
+	if count < 0 || len(data) < end {
+		return nil, nil, ErrIndexTruncated
+	}
+
+	word := func(i int) uint64 { return binary.BigEndian.Uint64(data[ewahHeaderSize+i*8:]) }
+	pos := 0
+
+	for i := 0; i < count; i++ {
+		rlw := word(i)
+		running := int(rlw>>1) & 0xffffffff
+		literals := int(rlw >> 33)
+
+		if rlw&1 != 0 {
+			for b := 0; b < running*ewahWordBits && pos+b < size; b++ {
+				bits = append(bits, pos+b)
+			}
+		}
+
+		pos += running * ewahWordBits
+
+		for ; literals > 0 && i+1 < count; literals-- {
+			i++
+
+			for lit, b := word(i), 0; lit != 0; lit, b = lit>>1, b+1 {
+				if lit&1 != 0 {
+					bits = append(bits, pos+b)
+				}
+			}
+
+			pos += ewahWordBits
+		}
+	}
+
+	for len(bits) > 0 && bits[len(bits)-1] >= size {
+		bits = bits[:len(bits)-1]
+	}
+
+	return bits, data[end:], nil
+}
+
+// HasSharedIndex is true for a split index, its other entries are in sharedindex.<hash>.
+func (idx *Index) HasSharedIndex() bool {
+	return idx.Link != nil && strings.Trim(idx.Link.SharedIndex, "0") != ""
+}
+
+// mergeShared builds the full index: shared entries are replaced by entries of this index in order,
+// deleted ones are removed and the remaining entries of this index are added.
+func (idx *Index) mergeShared(shared *Index) (err error) {
+	deleted := make(map[int]bool, len(idx.Link.Delete))
+	replaced := make(map[int]bool, len(idx.Link.Replace))
+
+	for _, pos := range idx.Link.Delete {
+		deleted[pos] = true
+	}
+
+	for _, pos := range idx.Link.Replace {
+		replaced[pos] = true
+	}
+
+	entries := make([]*IndexEntry, 0, len(shared.Entries)+len(idx.Entries))
+	next := 0
+
+	for pos, e := range shared.Entries {
+		if replaced[pos] {
+			if next >= len(idx.Entries) {
+				return fmt.Errorf("split index has %d entries, shared index replaces more", len(idx.Entries))
+			}
+
+			replacement := idx.Entries[next]
+			next++
+
+			// Replaced entries may have empty names to save space.
+			if replacement.Name == "" {
+				replacement.Name = e.Name
+			}
+
+			e = replacement
+		}
+
+		if !deleted[pos] {
+			entries = append(entries, e)
+		}
+	}
+
+	entries = append(entries, idx.Entries[next:]...)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+
+		return entries[i].Stage < entries[j].Stage
+	})
+
+	idx.Entries = entries
+
+	return
+}
+
+// Objects returns hashes of blobs and trees of index entries and extensions, gitlinks are skipped.
+func (idx *Index) Objects() (hashes []string) {
+	for _, e := range idx.Entries {
+		if e.Mode != filemode.Submodule {
+			hashes = append(hashes, e.Hash)
+		}
+	}
+
+	return append(hashes, idx.ExtensionObjects()...)
+}
+
+// ExtensionObjects returns hashes of trees of the cache tree and blobs of the resolve undo extension.
+func (idx *Index) ExtensionObjects() (hashes []string) {
+	for _, tree := range idx.Cache {
+		if tree.Hash != "" {
+			hashes = append(hashes, tree.Hash)
+		}
+	}
+
+	for _, reuc := range idx.ResolveUndo {
+		hashes = append(hashes, reuc.Hashes...)
+	}
+
+	return
+}
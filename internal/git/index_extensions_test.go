@@ -0,0 +1,121 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexCacheTreeAndResolveUndo(t *testing.T) {
+	blob := hashObject(FormatSHA1, ObjectBlob, []byte("a"))
+	theirs := hashObject(FormatSHA1, ObjectBlob, []byte("b"))
+	root := hashObject(FormatSHA1, ObjectTree, []byte("root"))
+	src := hashObject(FormatSHA1, ObjectTree, []byte("src"))
+
+	tree := append([]byte("\x001 2\n"), rawHash(root)...)
+	tree = append(append(tree, "src\x001 0\n"...), rawHash(src)...)
+	tree = append(tree, "vendor\x00-1 0\n"...)
+	reuc := append([]byte("src/db.php\x00100644\x000\x00100644\x00"), rawHash(blob)...)
+	reuc = append(reuc, rawHash(theirs)...)
+
+	data := withExtensions(FormatSHA1, createIndex(FormatSHA1, 2, []string{"src/db.php"}, []string{blob}),
+		indexExtension(indexExtTree, tree), indexExtension(indexExtResolveUndo, reuc), indexExtension("EOIE", []byte{0, 0, 0, 0}))
+
+	idx, err := NewIndexFromBytes(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []*IndexTree{
+		{Path: "", Entries: 1, Subtrees: 2, Hash: root},
+		{Path: "src", Entries: 1, Subtrees: 0, Hash: src},
+		{Path: "vendor", Entries: -1, Subtrees: 0},
+	}, idx.Cache)
+	assert.Equal(t, []*IndexResolveUndo{{Path: "src/db.php", Hashes: []string{blob, theirs}}}, idx.ResolveUndo)
+	assert.Equal(t, []string{blob, root, src, blob, theirs}, idx.Objects())
+
+	item := createItem(PathIndex, string(data), false)
+	paths, err := item.getPathFromIndexFile()
+	assert.NoError(t, err)
+	assert.Len(t, paths, 4)
+	assert.Equal(t, 1, item.indexFiles)
+	assert.Equal(t, 3, item.indexExtObjs)
+
+	_, err = NewIndexFromBytes(withExtensions(FormatSHA1, createIndex(FormatSHA1, 2, nil, nil), indexExtension("abcd", nil)))
+	assert.Error(t, err)
+}
+
+func TestSplitIndex(t *testing.T) {
+	hashes := []string{
+		hashObject(FormatSHA1, ObjectBlob, []byte("a")),
+		hashObject(FormatSHA1, ObjectBlob, []byte("b")),
+		hashObject(FormatSHA1, ObjectBlob, []byte("c")),
+		hashObject(FormatSHA1, ObjectBlob, []byte("b2")),
+		hashObject(FormatSHA1, ObjectBlob, []byte("d")),
+	}
+	shared := createIndex(FormatSHA1, 2, []string{"a", "b", "c"}, hashes[:3])
+	sharedHash := FormatSHA1.Sum(shared[:len(shared)-FormatSHA1.Size])
+
+	// "a" is deleted, "b" is replaced by the first entry without a name and "d" is added.
+	link := append(rawHash(sharedHash), ewahBitmap(3, 0b001)...)
+	link = append(link, ewahBitmap(3, 0b010)...)
+	split := withExtensions(FormatSHA1, createIndex(FormatSHA1, 2, []string{"", "d"}, hashes[3:]), indexExtension(indexExtLink, link))
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PathIndex), split, FilePerm))
+
+	_, err := NewIndexFromFile(filepath.Join(dir, PathIndex))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PathPrefixSharedIndex+sharedHash), shared, FilePerm))
+	idx, err := NewIndexFromFile(filepath.Join(dir, PathIndex))
+	assert.NoError(t, err)
+	assert.Len(t, idx.Entries, 3)
+
+	for i, name := range []string{"b", "c", "d"} {
+		assert.Equal(t, name, idx.Entries[i].Name)
+	}
+
+	assert.Equal(t, hashes[3], idx.Entries[0].Hash)
+
+	item := createItem(PathIndex, string(split), false)
+	paths, err := item.getPathFromIndexFile()
+	assert.NoError(t, err)
+	assert.True(t, paths[PathPrefixSharedIndex+sharedHash])
+	assert.True(t, isSharedIndexFile(PathPrefixSharedIndex+sharedHash))
+}
+
+func rawHash(hash string) []byte {
+	raw, _ := hex.DecodeString(hash)
+
+	return raw
+}
+
+func indexExtension(signature string, data []byte) []byte {
+	ext := binary.BigEndian.AppendUint32([]byte(signature), uint32(len(data)))
+
+	return append(ext, data...)
+}
+
+// withExtensions appends extensions to the index and computes its checksum again.
+func withExtensions(format *ObjectFormat, index []byte, extensions ...[]byte) []byte {
+	data := bytes.Clone(index[:len(index)-format.Size])
+
+	for _, ext := range extensions {
+		data = append(data, ext...)
+	}
+
+	return append(data, rawHash(format.Sum(data))...)
+}
+
+// ewahBitmap writes one run length word without running bits followed by one literal word.
+func ewahBitmap(size uint32, literal uint64) []byte {
+	data := binary.BigEndian.AppendUint32(nil, size)
+	data = binary.BigEndian.AppendUint32(data, 2)
+	data = binary.BigEndian.AppendUint64(data, 1<<33)
+	data = binary.BigEndian.AppendUint64(data, literal)
+
+	return binary.BigEndian.AppendUint32(data, 0)
+}
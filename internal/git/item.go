@@ -2,24 +2,21 @@ package git
 
 import (
 	"bytes"
-	"crypto/sha1"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 	"unsafe"
 
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/unsecured-company/gitrip/internal/application"
 	"github.com/unsecured-company/gitrip/internal/utils"
 )
 
-// TODO Better check for Exists
-
 type Item struct {
 	out           *application.Output
 	doRefs        bool
@@ -32,19 +29,34 @@ type Item struct {
 	fileSize      int
 	netFetchErr   error
 	netHttpCode   int
+	contentType   string
 	fileDirPath   string
-	regexpHash    *regexp.Regexp
+	tmpFile       string // downloaded data, moved into fileDirPath on save
+	isPartial     bool   // only the beginning of a large file is loaded
+	format        *ObjectFormat
 	objectType    string
+	packHashes    []string // objects stored in a pack, they do not need to be fetched as loose objects
+	tags          []*Tag
+	commits       []*Commit
+	trees         map[string][]TreeEntry // tree hash -> entries
+	submodules    []Submodule            // names from config, .gitmodules blobs and gitlinks in the index
+	configFormat  *ObjectFormat          // extensions.objectformat of the config
+	indexFiles    int                    // entries of the index
+	indexExtObjs  int                    // objects only in index extensions
+	branches      []string
+	remotes       []string
+	tagNames      []string
+	wgSave        *sync.WaitGroup // done once the item is saved
 }
 
-func NewItem(dirPath string, name string, doReferences bool, out *application.Output) (i *Item) {
+func NewItem(dirPath string, name string, doReferences bool, format *ObjectFormat, out *application.Output) (i *Item) {
 	i = &Item{}
 	i.out = out
-	i.regexpHash = regexp.MustCompile(HashRegexp)
+	i.format = format
 	i.fileDirPath = filepath.Join(dirPath, name)
 	i.doRefs = doReferences
 	i.fileName = name
-	i.isObject = strings.HasPrefix(name, PathPrefixObjects)
+	i.isObject = isObjectFile(name)
 	i.isObjectValid = i.isObject // by default valid
 
 	return
@@ -52,31 +64,77 @@ func NewItem(dirPath string, name string, doReferences bool, out *application.Ou
 
 func (it *Item) Save() (err error) {
 	if it.exists == false {
+		it.discard()
 		return
 	}
 
 	dir := filepath.Dir(it.fileDirPath)
 	err = os.MkdirAll(dir, DirPerm)
 
-	if err == nil {
+	if err == nil && it.tmpFile != "" {
+		err = os.Rename(it.tmpFile, it.fileDirPath)
+	} else if err == nil {
 		err = os.WriteFile(it.fileDirPath, it.fileData, FilePerm)
 	}
 
 	return
 }
 
+// discard removes the downloaded data of an item which will not be saved.
+func (it *Item) discard() {
+	if it.tmpFile != "" {
+		_ = os.Remove(it.tmpFile)
+	}
+}
+
 func (it *Item) Update(data []byte, code int, err error) {
 	it.fileData = data
 	it.netHttpCode = code
 	it.netFetchErr = err
 	it.fileSize = len(it.fileData)
-	it.exists = it.netFetchErr == nil && it.netHttpCode != http.StatusNotFound
+	it.exists = it.netFetchErr == nil && it.netHttpCode >= http.StatusOK && it.netHttpCode < http.StatusMultipleChoices
 	it.fileDataStr = *(*string)(unsafe.Pointer(&it.fileData))
 	// A string representation without copying the data. Will be overwritten if data are zlib compressed.
 }
 
+// UpdateFromFile loads the downloaded file, files over LimitParseSize only partially for validation.
+// Packs are always loaded partially, getPathsFromPack reads them from the file.
+func (it *Item) UpdateFromFile(tmpFile string, size int64, code int, err error) {
+	var data []byte
+	it.tmpFile = tmpFile
+	isPack := isPackFile(it.fileName, SuffixPack)
+
+	if err == nil && (isPack || size > application.LimitParseSize) {
+		it.isPartial = !isPack
+		data, err = readFilePrefix(tmpFile, partialLoadSize)
+	} else if err == nil {
+		data, err = os.ReadFile(tmpFile)
+	}
+
+	it.Update(data, code, err)
+	it.fileSize = int(size)
+}
+
+func readFilePrefix(path string, size int) (data []byte, err error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+	data = make([]byte, size)
+	n, err := io.ReadFull(file, data)
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	return data[:n], err
+}
+
 func (it *Item) GetPaths() (paths map[string]bool, err error) {
-	if it.fileName == PathPrefixHooks {
+	if it.fileName == PathPrefixHooks || it.isPartial {
 		return
 	}
 
@@ -88,11 +146,24 @@ func (it *Item) GetPaths() (paths map[string]bool, err error) {
 		return it.getPathsFromPacks()
 	}
 
+	if isPackFile(it.fileName, SuffixPack) {
+		return it.getPathsFromPack()
+	}
+
+	if isPackFile(it.fileName, SuffixPackIdx) {
+		return it.getPathsFromPackIndex()
+	}
+
 	if it.fileName == PathHead {
 		return it.getRefFromHead()
 	}
 
+	if isSharedIndexFile(it.fileName) {
+		return it.getPathFromIndexFile()
+	}
+
 	if !it.isObject {
+		it.findRefNames()
 		return it.findHashes()
 	}
 
@@ -112,9 +183,28 @@ func (it *Item) getPathFromIndexFile() (paths map[string]bool, err error) {
 		return paths, fmt.Errorf("Can not read index file: %v", err)
 	}
 
-	for _, e := range index.Index.Entries {
-		path, _ := HashToPath(it.regexpHash, e.Hash.String())
-		paths[path] = true
+	it.indexFiles = len(index.Entries)
+
+	// Gitlinks point to commits of the submodule, not of this repository.
+	for _, e := range index.Entries {
+		if e.Mode == filemode.Submodule {
+			it.submodules = append(it.submodules, Submodule{Path: e.Name})
+		} else if path, errH := HashToPath(it.format.Regexp, e.Hash); errH == nil {
+			paths[path] = true
+		}
+	}
+
+	// Trees of the cache extension recover whole directories even without commits.
+	for _, hash := range index.ExtensionObjects() {
+		if path, errH := HashToPath(it.format.Regexp, hash); errH == nil && !paths[path] {
+			paths[path] = true
+			it.indexExtObjs++
+		}
+	}
+
+	// A split index has the other entries in the shared index, which is read the same way.
+	if index.HasSharedIndex() {
+		paths[PathPrefixSharedIndex+index.Link.SharedIndex] = true
 	}
 
 	return
@@ -133,54 +223,93 @@ func (it *Item) getRefFromObject() (paths map[string]bool, err error) {
 
 	if err != nil {
 		if application.IgnoreInvalidObjectChecksum {
-			it.out.Logf("%v | File will still be saved and analyzed.")
+			it.out.Logf("%v | File will still be saved and analyzed.", err)
 		} else {
 			return
 		}
 	}
 
-	it.fileDataStr = string(data)
+	objType, content, err := splitObject(data)
 
-	if len(it.fileDataStr) < 8 {
-		return paths, fmt.Errorf("file too small: %s", it.fileName)
+	if err != nil {
+		it.objectType = "UNKNOWN"
+		return paths, fmt.Errorf("%w in %s", err, it.fileName)
 	}
 
-	start := it.fileDataStr[0:8]
+	it.objectType = objType
+	it.addTag(objType, content)
+	it.addCommit(hashFromObjectPath(it.fileName), objType, content)
+	it.addTree(hashFromObjectPath(it.fileName), objType, content)
+	it.addSubmodules(objType, content)
+	hashes, err := objectRefs(it.format, objType, content)
 
-	if strings.HasPrefix(start, "blob ") {
-		it.objectType = "blob"
+	for _, hash := range hashes {
+		if path, errN := it.hashToPath(hash); errN == nil {
+			paths[path] = true
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%w in %s", err, it.fileName)
+	}
+
+	return
+}
+
+func (it *Item) addTag(objType string, content []byte) {
+	if objType != ObjectTag {
 		return
-	} else if strings.HasPrefix(start, "tree ") {
-		it.objectType = "tree"
-		return it.parseGitTreeObject()
-	} else if strings.HasPrefix(start, "commit ") {
-		it.objectType = "commit"
-		return it.findHashes()
-	} else if strings.HasPrefix(start, "tag ") {
-		it.objectType = "tag"
-		return paths, fmt.Errorf("unsupported git object type 'tag' in %s", it.fileName) // TODO
-	} else {
-		it.objectType = "UNKNOWN"
-		return paths, fmt.Errorf("unsupported git object type '%s' in %s", start, it.fileName)
+	}
+
+	if tag, err := parseTag(content); err == nil {
+		it.tags = append(it.tags, tag)
+	}
+}
+
+func (it *Item) addCommit(hash string, objType string, content []byte) {
+	if objType != ObjectCommit {
+		return
+	}
+
+	if commit, err := parseCommit(content); err == nil {
+		commit.Hash = hash
+		it.commits = append(it.commits, commit)
+	}
+}
+
+func (it *Item) addTree(hash string, objType string, content []byte) {
+	if objType != ObjectTree {
+		return
+	}
+
+	if entries, err := parseTree(it.format, content); err == nil {
+		if it.trees == nil {
+			it.trees = make(map[string][]TreeEntry)
+		}
+
+		it.trees[hash] = entries
+	}
+}
+
+// addSubmodules reads blobs looking like .gitmodules, the blob itself does not know its file name.
+func (it *Item) addSubmodules(objType string, content []byte) {
+	if objType == ObjectBlob && bytes.Contains(content, []byte("[submodule")) {
+		it.submodules = append(it.submodules, submodulesFromConfig(string(content))...)
 	}
 }
 
 func (it *Item) checkObjectData(data []byte) (isValid bool, err error) {
-	orig := strings.TrimPrefix(it.fileName, "objects/")
-	orig = strings.ReplaceAll(orig, "/", "")
+	orig := hashFromObjectPath(it.fileName)
 
-	if len(orig) != 40 {
+	if !it.format.IsHash(orig) {
 		return false, fmt.Errorf("path is not object/XX/YYY..?")
 	}
 
-	h := sha1.New()
-	h.Write(data)
-	hash := hex.EncodeToString(h.Sum(nil))
-
+	hash := it.format.Sum(data)
 	isValid = hash == orig
 
 	if !isValid {
-		err = fmt.Errorf("object [%s] sha1 has not valid hash [%s]", it.fileName, hash)
+		err = fmt.Errorf("object [%s] %s has not valid hash [%s]", it.fileName, it.format.Name, hash)
 	}
 
 	return
@@ -192,7 +321,7 @@ func (it *Item) CheckObject() (isValid bool, err error) {
 
 func (it *Item) findHashes() (paths map[string]bool, err error) {
 	paths = make(map[string]bool)
-	hashes := it.regexpHash.FindAllString(it.fileDataStr, application.LimitHashes)
+	hashes := it.format.Regexp.FindAllString(it.fileDataStr, application.LimitHashes)
 
 	for _, hash := range hashes {
 		path, errN := it.hashToPath(hash)
@@ -203,43 +332,16 @@ func (it *Item) findHashes() (paths map[string]bool, err error) {
 	return
 }
 
-func (it *Item) parseGitTreeObject() (paths map[string]bool, err error) {
-	paths = make(map[string]bool)
-	reader := bytes.NewReader([]byte(it.fileDataStr))
-	var mode []byte
-
-	for {
-		mode, err = readUntilByte(reader, ' ')
-
-		if err != nil {
-			if err == io.EOF {
-				err = nil
-			} else {
-				err = fmt.Errorf("error reading 'mode' parameter: %v", err)
-			}
-
-			return
-		}
-
-		filename, err := readUntilByte(reader, 0)
-
-		if err != nil {
-			return paths, fmt.Errorf("error reading 'filename' parameter: %v", err)
-		}
-
-		_ = mode
-		_ = filename
-		var hash [20]byte
-
-		if _, err := io.ReadFull(reader, hash[:]); err != nil {
-			return paths, fmt.Errorf("error reading 'hash' parameter: %v", err)
-		}
-
-		path, err := it.hashToPath(hex.EncodeToString(hash[:]))
-
-		if err == nil {
-			paths[path] = true
-		}
+func (it *Item) findRefNames() {
+	switch {
+	case it.fileName == PathFetchHead:
+		it.branches, it.tagNames = refsFromFetchHead(it.fileDataStr)
+	case it.fileName == PathConfig:
+		it.branches, it.remotes = refsFromConfig(it.fileDataStr)
+		it.submodules = submodulesFromConfig(it.fileDataStr)
+		it.configFormat = formatFromConfig(it.fileDataStr)
+	case strings.HasPrefix(it.fileName, PathPrefixLog):
+		it.branches = branchesFromReflog(it.fileDataStr)
 	}
 }
 
@@ -254,6 +356,15 @@ func (it *Item) getPathsFromPacked() (paths map[string]bool, err error) {
 
 		parts := strings.Fields(line)
 
+		// Peeled line "^<hash>" holds the object an annotated tag above points to.
+		if len(parts) == 1 && strings.HasPrefix(parts[0], "^") {
+			if pathH, err := it.hashToPath(parts[0][1:]); err == nil {
+				paths[pathH] = true
+			}
+
+			continue
+		}
+
 		if len(parts) != 2 {
 			return paths, fmt.Errorf("Got %d instead of 2 parts for %s", len(parts), PathPacked)
 		}
@@ -273,7 +384,7 @@ func (it *Item) getPathsFromPacked() (paths map[string]bool, err error) {
 
 func (it *Item) getPathsFromPacks() (paths map[string]bool, err error) {
 	paths = make(map[string]bool)
-	hashes := it.regexpHash.FindAllString(it.fileDataStr, application.LimitHashes)
+	hashes := it.format.Regexp.FindAllString(it.fileDataStr, application.LimitHashes)
 
 	for _, hash := range hashes {
 		paths["objects/pack/pack-"+hash+".idx"] = true
@@ -284,6 +395,86 @@ func (it *Item) getPathsFromPacks() (paths map[string]bool, err error) {
 	return
 }
 
+func (it *Item) getPathsFromPackIndex() (paths map[string]bool, err error) {
+	paths = make(map[string]bool)
+	idx, err := NewPackIndexFromBytes(it.format, it.fileData)
+
+	if err != nil {
+		return paths, fmt.Errorf("%w in %s", err, it.fileName)
+	}
+
+	it.packHashes = idx.Hashes
+
+	return
+}
+
+// getPathsFromPack decodes packed objects one by one and returns loose paths of objects they reference outside the pack.
+// Objects which can not be decoded are skipped and reported in err.
+func (it *Item) getPathsFromPack() (paths map[string]bool, err error) {
+	var errs []error
+	paths = make(map[string]bool)
+	refs := make(map[string]bool)
+	packed := make(map[string]bool)
+	pack, err := it.openPack()
+
+	if err != nil {
+		return paths, fmt.Errorf("%w in %s", err, it.fileName)
+	}
+
+	defer pack.Close()
+
+	err = pack.Walk(func(obj *PackObject) {
+		packed[obj.Hash] = true
+		it.packHashes = append(it.packHashes, obj.Hash)
+		it.addTag(obj.Type, obj.Data)
+		it.addCommit(obj.Hash, obj.Type, obj.Data)
+		it.addTree(obj.Hash, obj.Type, obj.Data)
+		it.addSubmodules(obj.Type, obj.Data)
+		hashes, _ := objectRefs(it.format, obj.Type, obj.Data)
+
+		for _, hash := range hashes {
+			refs[hash] = true
+		}
+	}, func(offset int64, err error) {
+		errs = append(errs, fmt.Errorf("object at offset %d skipped: %w", offset, err))
+	})
+
+	for hash := range refs {
+		if packed[hash] {
+			continue
+		}
+
+		if path, errN := it.hashToPath(hash); errN == nil {
+			paths[path] = true
+		}
+	}
+
+	if err = errors.Join(append(errs, err)...); err != nil {
+		err = fmt.Errorf("%w in %s", err, it.fileName)
+	}
+
+	return
+}
+
+// openPack reads the pack from the downloaded file, with the index when it is already saved next to it.
+func (it *Item) openPack() (pack *Pack, err error) {
+	var idx *PackIndex
+
+	if it.fileDirPath != "" {
+		idxData, errR := os.ReadFile(strings.TrimSuffix(it.fileDirPath, SuffixPack) + SuffixPackIdx)
+
+		if errR == nil {
+			idx, _ = NewPackIndexFromBytes(it.format, idxData)
+		}
+	}
+
+	if it.tmpFile == "" {
+		return NewPackFromBytes(it.format, it.fileData, idx)
+	}
+
+	return NewPackFromFile(it.format, it.tmpFile, idx)
+}
+
 func (it *Item) getRefFromHead() (paths map[string]bool, err error) {
 	paths = make(map[string]bool)
 	var path string
@@ -308,7 +499,7 @@ func (it *Item) getRefFromHead() (paths map[string]bool, err error) {
 }
 
 func (it *Item) hashToPath(hash string) (path string, err error) {
-	path, err = HashToPath(it.regexpHash, hash)
+	path, err = HashToPath(it.format.Regexp, hash)
 
 	if err != nil {
 		err = fmt.Errorf("%w in %s", err, it.fileName)
@@ -3,6 +3,7 @@ package git
 import (
 	"bytes"
 	"compress/zlib"
+	"fmt"
 	"regexp"
 	"testing"
 
@@ -56,6 +57,8 @@ a102c2e103e1e534554702c142805a6d1eb22c03 refs/remotes/origin/test
 6f9c9f18558d33a45353fc4ed34b6a8f13220e59 refs/remotes/origin/test4
 09ef4a5225bcb3641a035b213927e290e2c1d477 refs/remotes/origin/test5
 0d5c35b213927e290e28c956d5849415947ccc31 refs/remotes/origin/test6
+b00007014ac2f0fb466f9b853b9c0a929d6cf8a4 refs/tags/v1.0.0
+^1e123d74161cd70f3bf678c2142034db220ada91
 `
 
 	refsDomina := refTest{
@@ -72,6 +75,8 @@ a102c2e103e1e534554702c142805a6d1eb22c03 refs/remotes/origin/test
 			"objects/6f/9c9f18558d33a45353fc4ed34b6a8f13220e59": true, "refs/remotes/origin/test4": true,
 			"objects/09/ef4a5225bcb3641a035b213927e290e2c1d477": true, "refs/remotes/origin/test5": true,
 			"objects/0d/5c35b213927e290e28c956d5849415947ccc31": true, "refs/remotes/origin/test6": true,
+			"objects/b0/0007014ac2f0fb466f9b853b9c0a929d6cf8a4": true, "refs/tags/v1.0.0": true,
+			"objects/1e/123d74161cd70f3bf678c2142034db220ada91": true,
 		},
 	}
 
@@ -200,6 +205,62 @@ meh
 	assert.NoError(t, err)
 }
 
+func TestGetReferencesFromObjectTag(t *testing.T) {
+	content := `object 652c5d72790ba74bd7b83f8b2a63bc942c2c304d
+type commit
+tag v1.0.0
+tagger Unsecured Company <git@unsecured.company> 1742629735 +0100
+
+Release 1.0.0
+`
+	hash := hashObject(FormatSHA1, ObjectTag, []byte(content))
+	path, _ := HashToPath(regexp.MustCompile(HashRegexp), hash)
+
+	item := createItem(path, fmt.Sprintf("%s %d\x00%s", ObjectTag, len(content), content), true)
+	refs, err := item.GetPaths()
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"objects/65/2c5d72790ba74bd7b83f8b2a63bc942c2c304d": true}, refs)
+	assert.Equal(t, ObjectTag, item.objectType)
+	assert.Len(t, item.tags, 1)
+	assert.Equal(t, "v1.0.0", item.tags[0].Name)
+	assert.Equal(t, "Release 1.0.0", item.tags[0].Message)
+}
+
+func TestGetReferencesFromObjectCommitParsed(t *testing.T) {
+	content := "tree b00007014ac2f0fb466f9b853b9c0a929d6cf8a4\n" +
+		"parent 1e123d74161cd70f3bf678c2142034db220ada91\n" +
+		"parent 34a8743de4384dc08f736eee2f35b0528e6a1321\n" +
+		"author Unsecured Company <git@unsecured.company> 1742629735 +0100\n" +
+		"committer Batman <batman@unsecured.company> 1742629800 -0500\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"Revert 652c5d72790ba74bd7b83f8b2a63bc942c2c304d\n"
+	hash := hashObject(FormatSHA1, ObjectCommit, []byte(content))
+	path, _ := HashToPath(regexp.MustCompile(HashRegexp), hash)
+
+	item := createItem(path, fmt.Sprintf("%s %d\x00%s", ObjectCommit, len(content), content), true)
+	refs, err := item.GetPaths()
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"objects/b0/0007014ac2f0fb466f9b853b9c0a929d6cf8a4": true,
+		"objects/1e/123d74161cd70f3bf678c2142034db220ada91": true,
+		"objects/34/a8743de4384dc08f736eee2f35b0528e6a1321": true,
+	}, refs)
+
+	assert.Len(t, item.commits, 1)
+	commit := item.commits[0]
+	assert.Equal(t, hash, commit.Hash)
+	assert.Equal(t, "Unsecured Company", commit.Author.Name)
+	assert.Equal(t, "git@unsecured.company", commit.Author.Email)
+	assert.Equal(t, int64(1742629800), commit.Committer.When.Unix())
+	_, offset := commit.Committer.When.Zone()
+	assert.Equal(t, -5*3600, offset)
+	assert.Equal(t, "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAdFiEE\n-----END PGP SIGNATURE-----", commit.GpgSig)
+	assert.Equal(t, "Revert 652c5d72790ba74bd7b83f8b2a63bc942c2c304d\n", commit.Message)
+}
+
 func createItem(fileName string, content string, isObject bool) *Item {
 	var data []byte
 
@@ -220,7 +281,7 @@ func createItem(fileName string, content string, isObject bool) *Item {
 		netFetchErr: nil,
 		netHttpCode: 200,
 		fileDirPath: "",
-		regexpHash:  regexp.MustCompile(HashRegexp),
+		format:      FormatSHA1,
 	}
 }
 
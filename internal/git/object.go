@@ -0,0 +1,275 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ObjectBlob     = "blob"
+	ObjectTree     = "tree"
+	ObjectCommit   = "commit"
+	ObjectTag      = "tag"
+	ModeTree       = "40000"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeGitlink    = "160000"
+)
+
+type Tag struct {
+	Object  string
+	Type    string
+	Name    string
+	Tagger  string
+	Message string
+}
+
+type Commit struct {
+	Hash      string    `json:"hash"`
+	Tree      string    `json:"tree"`
+	Parents   []string  `json:"parents,omitempty"`
+	Author    Signature `json:"author"`
+	Committer Signature `json:"committer"`
+	Encoding  string    `json:"encoding,omitempty"`
+	GpgSig    string    `json:"gpgsig,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// Signature is the author or committer "Name <email> timestamp timezone".
+type Signature struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	When  time.Time `json:"when"`
+}
+
+type TreeEntry struct {
+	Mode string
+	Name string
+	Hash string
+}
+
+// splitObject splits decoded loose object data "<type> <size>\x00<content>" into type and content.
+func splitObject(data []byte) (objType string, content []byte, err error) {
+	header, content, found := bytes.Cut(data, []byte{0})
+
+	if !found {
+		return "", nil, fmt.Errorf("object header is not terminated")
+	}
+
+	typeStr, sizeStr, found := bytes.Cut(header, []byte{' '})
+
+	if !found {
+		return "", nil, fmt.Errorf("invalid object header '%s'", header)
+	}
+
+	objType = string(typeStr)
+	size, err := strconv.Atoi(string(sizeStr))
+
+	if err != nil || size != len(content) {
+		return objType, content, fmt.Errorf("object size mismatch, header '%s', got %d", sizeStr, len(content))
+	}
+
+	return objType, content, nil
+}
+
+func hashObject(format *ObjectFormat, objType string, content []byte) string {
+	h := format.New()
+	h.Write([]byte(fmt.Sprintf("%s %d\x00", objType, len(content))))
+	h.Write(content)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func parseTree(format *ObjectFormat, content []byte) (entries []TreeEntry, err error) {
+	reader := bytes.NewReader(content)
+
+	for {
+		mode, err := readUntilByte(reader, ' ')
+
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, fmt.Errorf("error reading 'mode' parameter: %v", err)
+		}
+
+		filename, err := readUntilByte(reader, 0)
+
+		if err != nil {
+			return entries, fmt.Errorf("error reading 'filename' parameter: %v", err)
+		}
+
+		hash := make([]byte, format.Size)
+
+		if _, err := io.ReadFull(reader, hash); err != nil {
+			return entries, fmt.Errorf("error reading 'hash' parameter: %v", err)
+		}
+
+		entries = append(entries, TreeEntry{
+			Mode: string(mode),
+			Name: string(filename),
+			Hash: hex.EncodeToString(hash),
+		})
+	}
+}
+
+// commitTree returns the hash of the root tree of the commit.
+func commitTree(content []byte) (tree string, err error) {
+	line, _, _ := strings.Cut(string(content), "\n")
+	tree, found := strings.CutPrefix(line, "tree ")
+
+	if !found {
+		return "", fmt.Errorf("commit has no 'tree' header")
+	}
+
+	return
+}
+
+// parseCommit parses commit headers, values continued on lines starting with a space (gpgsig, mergetag) are joined.
+func parseCommit(content []byte) (commit *Commit, err error) {
+	commit = &Commit{}
+	headers, message, _ := strings.Cut(string(content), "\n\n")
+	commit.Message = message
+	var key, value string
+
+	for _, line := range strings.Split(headers, "\n") {
+		if cont, found := strings.CutPrefix(line, " "); found {
+			value += "\n" + cont
+		} else {
+			commit.setHeader(key, value)
+			key, value, _ = strings.Cut(line, " ")
+		}
+	}
+
+	commit.setHeader(key, value)
+
+	if !isHash(commit.Tree) {
+		return commit, fmt.Errorf("commit has no valid 'tree' header")
+	}
+
+	return
+}
+
+func (c *Commit) setHeader(key string, value string) {
+	switch key {
+	case "tree":
+		c.Tree = value
+	case "parent":
+		if isHash(value) {
+			c.Parents = append(c.Parents, value)
+		}
+	case "author":
+		c.Author = parseSignature(value)
+	case "committer":
+		c.Committer = parseSignature(value)
+	case "encoding":
+		c.Encoding = value
+	case "gpgsig", "gpgsig-sha256":
+		c.GpgSig = value
+	}
+}
+
+func parseSignature(value string) (sig Signature) {
+	name, rest, found := strings.Cut(value, " <")
+
+	if !found {
+		sig.Name = value
+		return
+	}
+
+	sig.Name = name
+	sig.Email, rest, _ = strings.Cut(rest, "> ")
+	timestamp, timezone, _ := strings.Cut(rest, " ")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return
+	}
+
+	sig.When = time.Unix(seconds, 0)
+
+	if zone, err := time.Parse("-0700", timezone); err == nil {
+		sig.When = sig.When.In(zone.Location())
+	}
+
+	return
+}
+
+// isHash accepts hashes of all object formats, the format of commits and tags is known from their length.
+func isHash(value string) bool {
+	if len(value) != FormatSHA1.Size*2 && len(value) != FormatSHA256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+
+	return err == nil
+}
+
+func parseTag(content []byte) (tag *Tag, err error) {
+	tag = &Tag{}
+	headers, message, _ := strings.Cut(string(content), "\n\n")
+	tag.Message = strings.TrimSpace(message)
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			tag.Tagger = value
+		}
+	}
+
+	if tag.Object == "" {
+		return tag, fmt.Errorf("tag object has no 'object' header")
+	}
+
+	return
+}
+
+// objectRefs returns hashes of objects referenced by the object content.
+func objectRefs(format *ObjectFormat, objType string, content []byte) (hashes []string, err error) {
+	switch objType {
+	case ObjectBlob:
+		return
+	case ObjectTree:
+		entries, err := parseTree(format, content)
+
+		for _, e := range entries {
+			// Gitlinks point to commits of another repository.
+			if e.Mode != ModeGitlink {
+				hashes = append(hashes, e.Hash)
+			}
+		}
+
+		return hashes, err
+	case ObjectCommit:
+		commit, err := parseCommit(content)
+
+		if err == nil {
+			hashes = append([]string{commit.Tree}, commit.Parents...)
+		}
+
+		return hashes, err
+	case ObjectTag:
+		tag, err := parseTag(content)
+
+		if err == nil {
+			hashes = append(hashes, tag.Object)
+		}
+
+		return hashes, err
+	default:
+		return hashes, fmt.Errorf("unsupported git object type '%s'", objType)
+	}
+}
@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+const (
+	HashRegexpSHA256 = `\b[0-9a-f]{64}\b`
+	FormatNameSHA1   = "sha1"
+	FormatNameSHA256 = "sha256"
+)
+
+var (
+	FormatSHA1   = newObjectFormat(FormatNameSHA1, sha1.Size, HashRegexp, sha1.New)
+	FormatSHA256 = newObjectFormat(FormatNameSHA256, sha256.Size, HashRegexpSHA256, sha256.New)
+
+	regexpConfigObjectFormat = regexp.MustCompile(`(?i)^objectformat\s*=\s*"?([a-z0-9]+)"?$`)
+)
+
+// ObjectFormat is the hash function of a repository, sha1 unless extensions.objectformat in its config says sha256.
+// It decides the length of hashes in text files, tree and index entries, and the checksums of files.
+type ObjectFormat struct {
+	Name    string
+	Size    int // bytes of binary hash, hex has twice as many characters
+	Regexp  *regexp.Regexp
+	newHash func() hash.Hash
+}
+
+func newObjectFormat(name string, size int, hashRegexp string, newHash func() hash.Hash) *ObjectFormat {
+	return &ObjectFormat{
+		Name:    name,
+		Size:    size,
+		Regexp:  regexp.MustCompile(hashRegexp),
+		newHash: newHash,
+	}
+}
+
+func (f *ObjectFormat) New() hash.Hash {
+	return f.newHash()
+}
+
+func (f *ObjectFormat) Sum(data []byte) string {
+	h := f.newHash()
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (f *ObjectFormat) IsHash(value string) bool {
+	return len(value) == f.Size*2 && isHash(value)
+}
+
+// hasChecksum is true when the file ends with the hash of its content, as the index and pack files do.
+func (f *ObjectFormat) hasChecksum(data []byte) bool {
+	if len(data) < f.Size {
+		return false
+	}
+
+	h := f.newHash()
+	h.Write(data[:len(data)-f.Size])
+
+	return bytes.Equal(h.Sum(nil), data[len(data)-f.Size:])
+}
+
+func objectFormatByName(name string) *ObjectFormat {
+	switch strings.ToLower(name) {
+	case FormatNameSHA1:
+		return FormatSHA1
+	case FormatNameSHA256:
+		return FormatSHA256
+	default:
+		return nil
+	}
+}
+
+// formatFromChecksum recognises the format by the checksum at the end of the file, nil when none matches.
+func formatFromChecksum(data []byte) *ObjectFormat {
+	for _, format := range []*ObjectFormat{FormatSHA1, FormatSHA256} {
+		if format.hasChecksum(data) {
+			return format
+		}
+	}
+
+	return nil
+}
+
+// formatFromConfig returns extensions.objectformat of the config, nil when it is not set.
+func formatFromConfig(data string) (format *ObjectFormat) {
+	var inExtensions bool
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			inExtensions = strings.EqualFold(strings.Trim(line, "[] \t"), "extensions")
+		} else if match := regexpConfigObjectFormat.FindStringSubmatch(line); match != nil && inExtensions {
+			format = objectFormatByName(match[1])
+		}
+	}
+
+	return
+}
+
+// formatFromDir reads the format of a dumped .git directory from its config, or from the index checksum.
+func formatFromDir(gitDir string) *ObjectFormat {
+	if data, err := os.ReadFile(filepath.Join(gitDir, PathConfig)); err == nil {
+		if format := formatFromConfig(string(data)); format != nil {
+			return format
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(gitDir, PathIndex)); err == nil {
+		if format := indexFormat(data); format != nil {
+			return format
+		}
+	}
+
+	return FormatSHA1
+}
+
+func (rp *Repo) objectFormat() *ObjectFormat {
+	return rp.format.Load()
+}
+
+// setObjectFormat switches the format of the repository, nil format is ignored.
+// The index and the config are checked before fetching starts, later config can only confirm or correct it.
+func (rp *Repo) setObjectFormat(format *ObjectFormat, source string) {
+	if format == nil {
+		return
+	}
+
+	if previous := rp.format.Swap(format); previous != format {
+		rp.logf("object format %s, detected from %s", format.Name, source)
+	}
+}
+
+// fetchObjectFormat reads extensions.objectformat of the config before fetching starts,
+// so HEAD and refs are parsed in the format of the repository. The config is then processed by processConfig.
+func (rp *Repo) fetchObjectFormat() {
+	urlItem := utils.GetNewSuffixedUrl(rp.Url, PathConfig)
+	data, httpCode, info, err := rp.dumper.fetcher.FetchWithInfo(rp.ctx, urlItem.String(), 4)
+
+	if err != nil {
+		return // Queued with other files, it is requested again.
+	}
+
+	rp.configItem = NewItem(rp.Dir, PathConfig, true, rp.objectFormat(), rp.out)
+	rp.configItem.Update(data, httpCode, err)
+	rp.configItem.contentType = info.ContentType
+
+	if httpCode == http.StatusOK {
+		rp.setObjectFormat(formatFromConfig(string(data)), PathConfig)
+	}
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFromConfig(t *testing.T) {
+	config := "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tobjectFormat = sha256\n"
+
+	assert.Equal(t, FormatSHA256, formatFromConfig(config))
+	assert.Nil(t, formatFromConfig("[core]\n\tbare = false\n"))
+	assert.Nil(t, formatFromConfig("[remote \"x\"]\n\tobjectformat = sha256\n"))
+}
+
+func TestSHA256Objects(t *testing.T) {
+	blob := []byte("SECRET=1\n")
+	blobHash := hashObject(FormatSHA256, ObjectBlob, blob)
+	rawHash, _ := hex.DecodeString(blobHash)
+	tree := append([]byte("100644 .env\x00"), rawHash...)
+
+	entries, err := parseTree(FormatSHA256, tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []TreeEntry{{Mode: "100644", Name: ".env", Hash: blobHash}}, entries)
+
+	treeHash := hashObject(FormatSHA256, ObjectTree, tree)
+	path, err := HashToPath(FormatSHA256.Regexp, treeHash)
+	assert.NoError(t, err)
+
+	item := createItem(path, fmt.Sprintf("tree %d\x00%s", len(tree), tree), true)
+	item.format = FormatSHA256
+	paths, err := item.GetPaths()
+	assert.NoError(t, err)
+	assert.True(t, item.isObjectValid)
+	assert.Contains(t, paths, "objects/"+blobHash[:2]+"/"+blobHash[2:])
+
+	_, err = HashToPath(FormatSHA1.Regexp, treeHash)
+	assert.Error(t, err)
+}
+
+func TestHashesOfOtherFormat(t *testing.T) {
+	hash := hashObject(FormatSHA256, ObjectCommit, []byte("tree\n"))
+
+	for _, format := range []*ObjectFormat{FormatSHA1, FormatSHA256} {
+		item := createItem("refs/heads/main", hash+"\n", false)
+		item.format = format
+		paths, err := item.GetPaths()
+		assert.NoError(t, err)
+
+		if format == FormatSHA256 {
+			assert.Equal(t, map[string]bool{"objects/" + hash[:2] + "/" + hash[2:]: true}, paths)
+		} else {
+			assert.Empty(t, paths, "SHA-256 hash must not match as SHA-1")
+		}
+	}
+
+	assert.Empty(t, FormatSHA1.Regexp.FindAllString(hash+"0", -1))
+	assert.Equal(t, []string{hash[:40]}, FormatSHA1.Regexp.FindAllString(hash[:40]+" "+hash[:41], -1))
+}
+
+func TestDecodeIndex(t *testing.T) {
+	hashes := []string{
+		hashObject(FormatSHA256, ObjectBlob, []byte("a")),
+		hashObject(FormatSHA256, ObjectBlob, []byte("b")),
+	}
+	names := []string{"src/app/config.php", "src/app/db.php"}
+
+	for _, version := range []uint32{2, 3, 4} {
+		idx, err := NewIndexFromBytes(createIndex(FormatSHA256, version, names, hashes))
+		assert.NoError(t, err, version)
+		assert.Equal(t, FormatSHA256, idx.Format)
+		assert.Len(t, idx.Entries, 2)
+		assert.Equal(t, names[1], idx.Entries[1].Name)
+		assert.Equal(t, hashes[1], idx.Entries[1].Hash)
+	}
+
+	data := createIndex(FormatSHA256, 2, names, hashes)
+	data[len(data)-1] ^= 0xff
+	_, err := NewIndexFromBytes(data)
+	assert.ErrorIs(t, err, ErrIndexChecksum)
+}
+
+func TestDecodeIndexSkipHash(t *testing.T) {
+	names := []string{"src/app/config.php", "src/app/db.php"}
+
+	for _, format := range []*ObjectFormat{FormatSHA1, FormatSHA256} {
+		hashes := []string{hashObject(format, ObjectBlob, []byte("a")), hashObject(format, ObjectBlob, []byte("b"))}
+
+		for _, version := range []uint32{2, 4} {
+			data := createIndex(format, version, names, hashes)
+			copy(data[len(data)-format.Size:], make([]byte, format.Size))
+
+			idx, err := NewIndexFromBytes(data)
+			require.NoError(t, err, format.Name, version)
+			assert.Equal(t, format, idx.Format)
+			assert.Equal(t, hashes[1], idx.Entries[1].Hash)
+			assert.Equal(t, format, indexFormat(data))
+		}
+	}
+}
+
+// createIndex writes entries with mode 100644, version 4 names are compressed against the previous one.
+func createIndex(format *ObjectFormat, version uint32, names []string, hashes []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(PrefixDIRC)
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{version, uint32(len(names))})
+	var prev string
+
+	for i, name := range names {
+		start := buf.Len()
+		_ = binary.Write(&buf, binary.BigEndian, []uint32{1, 0, 1, 0, 0, 0, 0100644, 0, 0, 1})
+		hash, _ := hex.DecodeString(hashes[i])
+		buf.Write(hash)
+		_ = binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+
+		if version == 4 {
+			common := 0
+
+			for common < len(prev) && common < len(name) && prev[common] == name[common] {
+				common++
+			}
+
+			buf.WriteByte(byte(len(prev) - common)) // fits into one byte in the test
+			buf.WriteString(name[common:])
+			buf.WriteByte(0)
+		} else {
+			buf.WriteString(name)
+			buf.Write(make([]byte, 8-(buf.Len()-start)%8))
+		}
+
+		prev = name
+	}
+
+	h := format.New()
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+
+	return buf.Bytes()
+}
@@ -0,0 +1,133 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+var (
+	ErrObjectMissing = errors.New("object is missing")
+	ErrObjectCorrupt = errors.New("object is corrupt")
+)
+
+// ObjectStore reads objects from a dumped .git directory, loose objects first, then packs.
+type ObjectStore struct {
+	dir    string
+	format *ObjectFormat
+	packs  []*Pack
+}
+
+func NewObjectStore(gitDir string) (store *ObjectStore, err error) {
+	store = &ObjectStore{
+		dir:    gitDir,
+		format: formatFromDir(gitDir),
+	}
+
+	packFiles, err := filepath.Glob(filepath.Join(gitDir, PathPrefixPack, "pack-*"+SuffixPack))
+
+	if err != nil {
+		return
+	}
+
+	for _, packFile := range packFiles {
+		pack, errN := store.loadPack(packFile)
+
+		if errN != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", filepath.Base(packFile), errN))
+		}
+
+		if pack != nil {
+			store.packs = append(store.packs, pack)
+		}
+	}
+
+	return
+}
+
+// Close releases the pack files.
+func (s *ObjectStore) Close() {
+	for _, pack := range s.packs {
+		_ = pack.Close()
+	}
+}
+
+// Object returns type and content of the object.
+func (s *ObjectStore) Object(hash string) (objType string, content []byte, err error) {
+	path, err := HashToPath(s.format.Regexp, hash)
+
+	if err != nil {
+		return
+	}
+
+	objType, content, err = s.looseObject(hash, path)
+
+	if err == nil {
+		return
+	}
+
+	// A corrupt loose object can still be packed.
+	for _, pack := range s.packs {
+		obj, errN := pack.Object(hash)
+
+		if errN == nil && obj.Hash != hash {
+			return obj.Type, obj.Data, fmt.Errorf("%s: %w: packed object checksum mismatch", hash, ErrObjectCorrupt)
+		} else if errN == nil {
+			return obj.Type, obj.Data, nil
+		}
+	}
+
+	return "", nil, err
+}
+
+func (s *ObjectStore) looseObject(hash string, path string) (objType string, content []byte, err error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, path))
+
+	if os.IsNotExist(err) {
+		return "", nil, fmt.Errorf("%s: %w", hash, ErrObjectMissing)
+	} else if err != nil {
+		return
+	}
+
+	data, err = utils.DecodeZlib(data)
+
+	if err == nil {
+		objType, content, err = splitObject(data)
+	}
+
+	if err == nil && hashObject(s.format, objType, content) != hash {
+		err = errors.New("checksum mismatch")
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%s: %w: %v", hash, ErrObjectCorrupt, err)
+	}
+
+	return
+}
+
+func (s *ObjectStore) loadPack(packFile string) (pack *Pack, err error) {
+	var idx *PackIndex
+	idxData, err := os.ReadFile(strings.TrimSuffix(packFile, SuffixPack) + SuffixPackIdx)
+
+	if err == nil {
+		idx, err = NewPackIndexFromBytes(s.format, idxData)
+	}
+
+	if err != nil {
+		idx = nil
+	}
+
+	pack, err = NewPackFromFile(s.format, packFile, idx)
+
+	if err == nil && idx == nil {
+		// Without the index all objects have to be decoded to learn their hashes.
+		err = pack.Walk(func(*PackObject) {}, nil)
+	}
+
+	return
+}
@@ -0,0 +1,571 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const (
+	packHeaderSize    = 12
+	packTypeCommit    = 1
+	packTypeTree      = 2
+	packTypeBlob      = 3
+	packTypeTag       = 4
+	packTypeOfsDelta  = 6
+	packTypeRefDelta  = 7
+	packMaxDeltaDepth = 10_000
+	packMaxObjectSize = 1 << 30  // objects are decoded in memory, larger ones are skipped
+	packCacheSize     = 64 << 20 // decoded objects kept as delta bases
+)
+
+var (
+	packMagic          = []byte("PACK")
+	errPackBaseMissing = errors.New("delta base object is not in the pack")
+	errPackChecksum    = errors.New("pack checksum does not match its content")
+	errPackObjectSize  = errors.New("pack object size")
+)
+
+type PackObject struct {
+	Hash   string
+	Type   string
+	Data   []byte
+	Offset int64
+}
+
+// Pack decodes objects from objects/pack/pack-<hash>.pack, one by one, so packs larger than memory can be read.
+// Index is optional, without it the pack is scanned sequentially.
+type Pack struct {
+	format    *ObjectFormat
+	reader    io.ReaderAt
+	closer    io.Closer
+	size      int64
+	index     *PackIndex
+	count     int
+	hashes    map[string]int64 // learned while walking a pack without index
+	cache     map[int64]*PackObject
+	cacheSize int
+}
+
+type packEntry struct {
+	typ        int
+	data       []byte
+	baseOffset int64
+	baseHash   string
+	next       int64
+}
+
+// NewPack reads the pack header, the index is ignored when it belongs to another pack.
+func NewPack(format *ObjectFormat, reader io.ReaderAt, size int64, index *PackIndex) (pack *Pack, err error) {
+	if size < int64(packHeaderSize+format.Size) {
+		return nil, fmt.Errorf("pack too small, %d bytes", size)
+	}
+
+	header := make([]byte, packHeaderSize)
+	trailer := make([]byte, format.Size)
+
+	if _, err = reader.ReadAt(header, 0); err != nil {
+		return
+	}
+
+	if _, err = reader.ReadAt(trailer, size-int64(format.Size)); err != nil {
+		return
+	}
+
+	if !bytes.Equal(header[:4], packMagic) {
+		return nil, fmt.Errorf("pack has invalid magic")
+	}
+
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported pack version %d", version)
+	}
+
+	if index != nil && index.PackChecksum != hex.EncodeToString(trailer) {
+		index = nil
+	}
+
+	pack = &Pack{
+		format: format,
+		reader: reader,
+		size:   size,
+		index:  index,
+		count:  int(binary.BigEndian.Uint32(header[8:12])),
+		hashes: make(map[string]int64),
+		cache:  make(map[int64]*PackObject),
+	}
+
+	return
+}
+
+func NewPackFromBytes(format *ObjectFormat, data []byte, index *PackIndex) (pack *Pack, err error) {
+	return NewPack(format, bytes.NewReader(data), int64(len(data)), index)
+}
+
+// NewPackFromFile keeps the file open, Close must follow.
+func NewPackFromFile(format *ObjectFormat, path string, index *PackIndex) (pack *Pack, err error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+
+	if err == nil {
+		pack, err = NewPack(format, file, info.Size(), index)
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	pack.closer = file
+
+	return
+}
+
+func (p *Pack) Close() (err error) {
+	if p.closer != nil {
+		err = p.closer.Close()
+	}
+
+	return
+}
+
+func (p *Pack) Count() int {
+	return p.count
+}
+
+// Walk decodes objects one by one and passes them to fn, the data must not be kept by it.
+// Objects which can not be decoded (too large, broken or with a delta base missing in a thin pack) are passed to skip.
+// err is set when the rest of the pack can not be read.
+func (p *Pack) Walk(fn func(obj *PackObject), skip func(offset int64, err error)) (err error) {
+	var pending, offsets []int64
+	offset := int64(packHeaderSize)
+
+	// Objects in offset order find their OFS_DELTA bases in the cache.
+	if p.index != nil {
+		offsets = slices.Sorted(slices.Values(p.index.Offsets))
+	}
+
+	skipped := func(offset int64, err error) {
+		if skip != nil {
+			skip(offset, err)
+		}
+	}
+
+	for i := 0; i < p.count; i++ {
+		if p.index != nil && i < len(offsets) {
+			offset = offsets[i]
+		}
+
+		entry, errE := p.readEntry(offset)
+
+		if entry == nil && p.index == nil {
+			// The end of the object is not known, so neither the next one.
+			return fmt.Errorf("object %d/%d at offset %d: %w", i+1, p.count, offset, errE)
+		}
+
+		var obj *PackObject
+
+		if errE == nil {
+			obj, errE = p.resolve(offset, entry, 0)
+		}
+
+		if errors.Is(errE, errPackBaseMissing) {
+			pending = append(pending, offset)
+		} else if errE != nil {
+			skipped(offset, errE)
+		} else {
+			fn(obj)
+		}
+
+		if entry != nil {
+			offset = entry.next
+		}
+	}
+
+	// REF_DELTA base may be stored after the delta itself, repeat while there is progress.
+	for len(pending) > 0 {
+		var left []int64
+
+		for _, offset := range pending {
+			obj, errO := p.ObjectAt(offset)
+
+			if errors.Is(errO, errPackBaseMissing) {
+				left = append(left, offset)
+			} else if errO != nil {
+				skipped(offset, errO)
+			} else {
+				fn(obj)
+			}
+		}
+
+		if len(left) == len(pending) {
+			for _, offset := range left {
+				skipped(offset, errPackBaseMissing)
+			}
+
+			break
+		}
+
+		pending = left
+	}
+
+	return
+}
+
+func (p *Pack) Object(hash string) (obj *PackObject, err error) {
+	offset, found := p.offsetOf(hash)
+
+	if !found {
+		return nil, fmt.Errorf("object %s not found in pack", hash)
+	}
+
+	return p.ObjectAt(offset)
+}
+
+func (p *Pack) ObjectAt(offset int64) (obj *PackObject, err error) {
+	return p.objectAt(offset, 0)
+}
+
+func (p *Pack) objectAt(offset int64, depth int) (obj *PackObject, err error) {
+	if obj, found := p.cache[offset]; found {
+		return obj, nil
+	}
+
+	entry, err := p.readEntry(offset)
+
+	if err != nil {
+		return
+	}
+
+	return p.resolve(offset, entry, depth)
+}
+
+// resolve builds the object of the entry, delta bases are read recursively.
+func (p *Pack) resolve(offset int64, entry *packEntry, depth int) (obj *PackObject, err error) {
+	if depth > packMaxDeltaDepth {
+		return nil, fmt.Errorf("delta chain too long at offset %d", offset)
+	}
+
+	obj = &PackObject{Offset: offset}
+
+	switch entry.typ {
+	case packTypeOfsDelta, packTypeRefDelta:
+		baseOffset := entry.baseOffset
+
+		if entry.typ == packTypeRefDelta {
+			var found bool
+			baseOffset, found = p.offsetOf(entry.baseHash)
+
+			if !found {
+				return nil, fmt.Errorf("%s: %w", entry.baseHash, errPackBaseMissing)
+			}
+		}
+
+		base, err := p.objectAt(baseOffset, depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj.Type = base.Type
+		obj.Data, err = applyDelta(base.Data, entry.data)
+
+		if err != nil {
+			return nil, fmt.Errorf("delta at offset %d: %w", offset, err)
+		}
+	default:
+		obj.Type, err = packTypeName(entry.typ)
+		obj.Data = entry.data
+
+		if err != nil {
+			return
+		}
+	}
+
+	obj.Hash = hashObject(p.format, obj.Type, obj.Data)
+	p.addToCache(obj)
+
+	if p.index == nil {
+		p.hashes[obj.Hash] = offset
+	}
+
+	return
+}
+
+// addToCache keeps recent objects for deltas, the cache starts again when it is full.
+func (p *Pack) addToCache(obj *PackObject) {
+	if len(obj.Data) > packCacheSize {
+		return
+	}
+
+	if p.cacheSize+len(obj.Data) > packCacheSize {
+		clear(p.cache)
+		p.cacheSize = 0
+	}
+
+	p.cache[obj.Offset] = obj
+	p.cacheSize += len(obj.Data)
+}
+
+func (p *Pack) offsetOf(hash string) (offset int64, found bool) {
+	if offset, found = p.hashes[hash]; found {
+		return
+	}
+
+	if p.index != nil {
+		return p.index.Offset(hash)
+	}
+
+	return
+}
+
+// readEntry inflates the object at the offset. Objects over packMaxObjectSize are inflated
+// without keeping the data, to find where the next one starts, the entry comes with errPackObjectSize.
+func (p *Pack) readEntry(offset int64) (entry *packEntry, err error) {
+	end := p.size - int64(p.format.Size)
+
+	if offset < packHeaderSize || offset >= end {
+		return nil, fmt.Errorf("offset %d out of range", offset)
+	}
+
+	// Zlib reads exactly its stream from a ByteReader, the next object starts after it.
+	section := io.NewSectionReader(p.reader, offset, end-offset)
+	reader := bufio.NewReader(section)
+	c, err := reader.ReadByte()
+
+	if err != nil {
+		return nil, fmt.Errorf("reading object header: %w", err)
+	}
+
+	entry = &packEntry{typ: int(c>>4) & 7}
+	size := uint64(c & 0x0f)
+
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = reader.ReadByte(); err != nil {
+			return nil, fmt.Errorf("reading object header: %w", err)
+		}
+
+		if shift > 56 {
+			return nil, fmt.Errorf("%w: header too long", errPackObjectSize)
+		}
+
+		size |= uint64(c&0x7f) << shift
+	}
+
+	switch entry.typ {
+	case packTypeOfsDelta:
+		c, err = reader.ReadByte()
+		rel := int64(c & 0x7f)
+
+		for err == nil && c&0x80 != 0 {
+			c, err = reader.ReadByte()
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading delta offset: %w", err)
+		}
+
+		entry.baseOffset = offset - rel
+	case packTypeRefDelta:
+		hash := make([]byte, p.format.Size)
+
+		if _, err = io.ReadFull(reader, hash); err != nil {
+			return nil, fmt.Errorf("reading delta base: %w", err)
+		}
+
+		entry.baseHash = hex.EncodeToString(hash)
+	}
+
+	zr, err := zlib.NewReader(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("object data: %w", err)
+	}
+
+	// The size from the header stops decompression bombs.
+	data := io.LimitReader(zr, int64(size)+1)
+	var inflated int64
+
+	if size > packMaxObjectSize {
+		inflated, err = io.Copy(io.Discard, data)
+	} else {
+		entry.data, err = io.ReadAll(data)
+		inflated = int64(len(entry.data))
+	}
+
+	_ = zr.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("object data: %w", err)
+	}
+
+	if uint64(inflated) != size {
+		return nil, fmt.Errorf("%w: header says %d bytes, data has more or less", errPackObjectSize, size)
+	}
+
+	pos, _ := section.Seek(0, io.SeekCurrent)
+	entry.next = offset + pos - int64(reader.Buffered())
+
+	if size > packMaxObjectSize {
+		return entry, fmt.Errorf("%w: %d bytes, over %d", errPackObjectSize, size, packMaxObjectSize)
+	}
+
+	return
+}
+
+func packTypeName(typ int) (string, error) {
+	switch typ {
+	case packTypeCommit:
+		return ObjectCommit, nil
+	case packTypeTree:
+		return ObjectTree, nil
+	case packTypeBlob:
+		return ObjectBlob, nil
+	case packTypeTag:
+		return ObjectTag, nil
+	default:
+		return "", fmt.Errorf("unknown pack object type %d", typ)
+	}
+}
+
+// applyDelta builds the target object from its base and git delta instructions.
+func applyDelta(base []byte, delta []byte) (target []byte, err error) {
+	reader := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading base size: %w", err)
+	}
+
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("base size mismatch, expected %d, got %d", baseSize, len(base))
+	}
+
+	targetSize, err := binary.ReadUvarint(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading target size: %w", err)
+	}
+
+	// Target size comes from the server, it is checked before allocating.
+	if targetSize > packMaxObjectSize {
+		return nil, fmt.Errorf("%w: target over %d bytes", errPackObjectSize, packMaxObjectSize)
+	}
+
+	target = make([]byte, 0, targetSize)
+
+	for {
+		op, err := reader.ReadByte()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if op&0x80 == 0 {
+			if op == 0 {
+				return nil, fmt.Errorf("invalid delta opcode 0")
+			}
+
+			start := len(target)
+			target = append(target, make([]byte, op)...)
+
+			if _, err = io.ReadFull(reader, target[start:]); err != nil {
+				return nil, fmt.Errorf("reading inserted data: %w", err)
+			}
+
+			continue
+		}
+
+		var copyOffset, copySize uint64
+
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+
+			b, err := reader.ReadByte()
+
+			if err != nil {
+				return nil, fmt.Errorf("reading copy instruction: %w", err)
+			}
+
+			if i < 4 {
+				copyOffset |= uint64(b) << (8 * i)
+			} else {
+				copySize |= uint64(b) << (8 * (i - 4))
+			}
+		}
+
+		if copySize == 0 {
+			copySize = 0x10000
+		}
+
+		if copyOffset+copySize > uint64(len(base)) {
+			return nil, fmt.Errorf("copy out of base range %d+%d", copyOffset, copySize)
+		}
+
+		if uint64(len(target))+copySize > targetSize {
+			return nil, fmt.Errorf("copy over target size %d", targetSize)
+		}
+
+		target = append(target, base[copyOffset:copyOffset+copySize]...)
+	}
+
+	if uint64(len(target)) != targetSize {
+		return nil, fmt.Errorf("target size mismatch, expected %d, got %d", targetSize, len(target))
+	}
+
+	return
+}
+
+// verifyPackTrailer compares the checksum at the end of the pack file with its content, without loading it.
+func verifyPackTrailer(format *ObjectFormat, path string) (err error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+	info, err := file.Stat()
+
+	if err != nil {
+		return
+	}
+
+	if info.Size() < int64(packHeaderSize+format.Size) {
+		return fmt.Errorf("%w: file too short", errPackChecksum)
+	}
+
+	h := format.New()
+
+	if _, err = io.CopyN(h, file, info.Size()-int64(format.Size)); err != nil {
+		return
+	}
+
+	trailer := make([]byte, format.Size)
+
+	if _, err = io.ReadFull(file, trailer); err != nil {
+		return
+	}
+
+	if !bytes.Equal(h.Sum(nil), trailer) {
+		return errPackChecksum
+	}
+
+	return
+}
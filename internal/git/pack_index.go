@@ -0,0 +1,89 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	packIdxVersion    = 2
+	packIdxFanoutSize = 256 * 4
+	packIdxHeaderSize = 8
+	packIdxLargeFlag  = 0x80000000
+)
+
+var packIdxMagic = []byte{0xff, 't', 'O', 'c'}
+
+// PackIndex is a decoded objects/pack/pack-<hash>.idx file (version 2).
+type PackIndex struct {
+	Hashes       []string
+	Offsets      []int64 // Offsets[i] belongs to Hashes[i]
+	PackChecksum string
+	offsets      map[string]int64
+}
+
+func NewPackIndexFromBytes(format *ObjectFormat, data []byte) (idx *PackIndex, err error) {
+	hashSize := format.Size
+
+	if len(data) < packIdxHeaderSize+packIdxFanoutSize+2*hashSize {
+		return nil, fmt.Errorf("pack index too small, %d bytes", len(data))
+	}
+
+	if !bytes.Equal(data[:4], packIdxMagic) {
+		return nil, fmt.Errorf("pack index has invalid magic, only version %d is supported", packIdxVersion)
+	}
+
+	if version := binary.BigEndian.Uint32(data[4:8]); version != packIdxVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	fanout := data[packIdxHeaderSize : packIdxHeaderSize+packIdxFanoutSize]
+	count := int(binary.BigEndian.Uint32(fanout[packIdxFanoutSize-4:]))
+
+	posHashes := packIdxHeaderSize + packIdxFanoutSize
+	posCrc := posHashes + count*hashSize
+	posOffsets := posCrc + count*4
+	posLarge := posOffsets + count*4
+
+	if len(data) < posLarge+2*hashSize {
+		return nil, fmt.Errorf("pack index truncated, %d objects in %d bytes", count, len(data))
+	}
+
+	idx = &PackIndex{
+		Hashes:  make([]string, count),
+		Offsets: make([]int64, count),
+		offsets: make(map[string]int64, count),
+	}
+
+	for i := 0; i < count; i++ {
+		pos := posHashes + i*hashSize
+		hash := hex.EncodeToString(data[pos : pos+hashSize])
+		offset := int64(binary.BigEndian.Uint32(data[posOffsets+i*4:]))
+
+		if offset&packIdxLargeFlag != 0 {
+			pos = posLarge + int(offset&^packIdxLargeFlag)*8
+
+			if len(data) < pos+8+2*hashSize {
+				return nil, fmt.Errorf("pack index large offset out of range for %s", hash)
+			}
+
+			offset = int64(binary.BigEndian.Uint64(data[pos:]))
+		}
+
+		idx.Hashes[i] = hash
+		idx.Offsets[i] = offset
+		idx.offsets[hash] = offset
+	}
+
+	idx.PackChecksum = hex.EncodeToString(data[len(data)-2*hashSize : len(data)-hashSize])
+
+	return
+}
+
+func (idx *PackIndex) Offset(hash string) (offset int64, found bool) {
+	offset, found = idx.offsets[hash]
+
+	return
+}
@@ -0,0 +1,309 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type packTestObject struct {
+	typ      int
+	data     []byte
+	baseIdx  int // index of the base object for deltas
+	baseHash string
+	size     int // size in the object header, the data length when zero
+}
+
+func TestPackObjectsWithDeltas(t *testing.T) {
+	blob := []byte("first line\nsecond line\n")
+	blobChanged := []byte("first line\nsecond line\nthird line\n")
+	externalHash := "b00007014ac2f0fb466f9b853b9c0a929d6cf8a4"
+	blobHash := hashObject(FormatSHA1, ObjectBlob, blob)
+	tree := treeContent(t, "100644 a.txt", blobHash, "100644 ext.txt", externalHash)
+
+	packData, _ := createPack([]packTestObject{
+		{typ: packTypeBlob, data: blob},
+		{typ: packTypeOfsDelta, data: createDelta(blob, blobChanged), baseIdx: 0},
+		{typ: packTypeRefDelta, data: createDelta(blob, blobChanged), baseHash: blobHash},
+		{typ: packTypeTree, data: tree},
+	})
+
+	pack, err := NewPackFromBytes(FormatSHA1, packData, nil)
+	require.NoError(t, err)
+
+	objects, err := walkPack(pack)
+	require.NoError(t, err)
+	require.Len(t, objects, 4)
+
+	assert.Equal(t, blobHash, objects[0].Hash)
+	assert.Equal(t, ObjectBlob, objects[1].Type)
+	assert.Equal(t, blobChanged, objects[1].Data)
+	assert.Equal(t, blobChanged, objects[2].Data)
+	assert.Equal(t, hashObject(FormatSHA1, ObjectBlob, blobChanged), objects[2].Hash)
+	assert.Equal(t, ObjectTree, objects[3].Type)
+}
+
+func TestPackIndex(t *testing.T) {
+	blob := []byte("indexed blob\n")
+	blobChanged := []byte("indexed blob\nchanged\n")
+	packData, offsets := createPack([]packTestObject{
+		{typ: packTypeBlob, data: blob},
+		{typ: packTypeOfsDelta, data: createDelta(blob, blobChanged), baseIdx: 0},
+	})
+	hashes := []string{hashObject(FormatSHA1, ObjectBlob, blob), hashObject(FormatSHA1, ObjectBlob, blobChanged)}
+
+	idx, err := NewPackIndexFromBytes(FormatSHA1, createPackIndex(hashes, offsets, packData))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, hashes, idx.Hashes)
+
+	pack, err := NewPackFromBytes(FormatSHA1, packData, idx)
+	require.NoError(t, err)
+
+	obj, err := pack.Object(hashes[1])
+	require.NoError(t, err)
+	assert.Equal(t, blobChanged, obj.Data)
+
+	objects, err := walkPack(pack)
+	require.NoError(t, err)
+	assert.Len(t, objects, 2)
+}
+
+func TestPackWalkSkipsObjects(t *testing.T) {
+	blob := []byte("base after its delta\n")
+	blobChanged := []byte("base after its delta\nchanged\n")
+	blobHash := hashObject(FormatSHA1, ObjectBlob, blob)
+	missingHash := "1e123d74161cd70f3bf678c2142034db220ada91"
+
+	packData, offsets := createPack([]packTestObject{
+		{typ: packTypeRefDelta, data: createDelta(blob, blobChanged), baseHash: blobHash},
+		{typ: packTypeRefDelta, data: createDelta(blob, blobChanged), baseHash: missingHash},
+		{typ: packTypeBlob, data: blob},
+	})
+
+	pack, err := NewPackFromBytes(FormatSHA1, packData, nil)
+	require.NoError(t, err)
+
+	var objects []*PackObject
+	skipped := make(map[int64]error)
+	err = pack.Walk(func(obj *PackObject) {
+		objects = append(objects, obj)
+	}, func(offset int64, err error) {
+		skipped[offset] = err
+	})
+
+	assert.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, blob, objects[0].Data)
+	assert.Equal(t, blobChanged, objects[1].Data)
+	require.Len(t, skipped, 1)
+	assert.ErrorIs(t, skipped[offsets[1]], errPackBaseMissing)
+}
+
+func TestGetReferencesFromPack(t *testing.T) {
+	blob := []byte("packed\n")
+	blobHash := hashObject(FormatSHA1, ObjectBlob, blob)
+	missingHash := "1e123d74161cd70f3bf678c2142034db220ada91"
+	tree := treeContent(t, "100644 packed.txt", blobHash, "100644 loose.txt", missingHash)
+
+	packData, _ := createPack([]packTestObject{
+		{typ: packTypeBlob, data: blob},
+		{typ: packTypeTree, data: tree},
+	})
+
+	item := createItem("objects/pack/pack-45e49368a99785ecc6638838b6a969a6f40b3516.pack", string(packData), false)
+	refs, err := item.GetPaths()
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"objects/1e/123d74161cd70f3bf678c2142034db220ada91": true}, refs)
+	assert.Len(t, item.packHashes, 2)
+
+	// Large packs are read from the downloaded file, only its beginning is loaded.
+	item = createItem(item.fileName, "", false)
+	tmpFile := filepath.Join(t.TempDir(), "pack.part")
+	require.NoError(t, os.WriteFile(tmpFile, packData, FilePerm))
+	item.UpdateFromFile(tmpFile, int64(len(packData)), http.StatusOK, nil)
+	refs, err = item.GetPaths()
+
+	assert.NoError(t, err)
+	assert.False(t, item.isPartial)
+	assert.Equal(t, map[string]bool{"objects/1e/123d74161cd70f3bf678c2142034db220ada91": true}, refs)
+	assert.Len(t, item.packHashes, 2)
+}
+
+func TestPackObjectSizeLimits(t *testing.T) {
+	blob := []byte("compressed much better than it says\n")
+
+	for _, size := range []int{len(blob) - 1, len(blob) + 1, packMaxObjectSize + 1} {
+		packData, _ := createPack([]packTestObject{{typ: packTypeBlob, data: blob, size: size}})
+		pack, err := NewPackFromBytes(FormatSHA1, packData, nil)
+		require.NoError(t, err)
+
+		_, err = walkPack(pack)
+		assert.ErrorIs(t, err, errPackObjectSize, size)
+	}
+
+	delta := append(binary.AppendUvarint(nil, uint64(len(blob))), binary.AppendUvarint(nil, 1<<62)...)
+	_, err := applyDelta(blob, delta)
+	assert.ErrorIs(t, err, errPackObjectSize)
+
+	// Copies the base twice into a target of its size.
+	delta = append(binary.AppendUvarint(nil, uint64(len(blob))), binary.AppendUvarint(nil, uint64(len(blob)))...)
+	delta = append(delta, 0x80|0x10, byte(len(blob)), 0x80|0x10, byte(len(blob)))
+	_, err = applyDelta(blob, delta)
+	assert.Error(t, err)
+}
+
+func TestVerifyPackTrailer(t *testing.T) {
+	packData, _ := createPack([]packTestObject{{typ: packTypeBlob, data: []byte("blob\n")}})
+	path := filepath.Join(t.TempDir(), "pack.part")
+
+	require.NoError(t, os.WriteFile(path, packData, FilePerm))
+	assert.NoError(t, verifyPackTrailer(FormatSHA1, path))
+
+	require.NoError(t, os.WriteFile(path, packData[:len(packData)-5], FilePerm))
+	assert.ErrorIs(t, verifyPackTrailer(FormatSHA1, path), errPackChecksum)
+}
+
+// walkPack collects all objects, a skipped object is returned as the error.
+func walkPack(pack *Pack) (objects []*PackObject, err error) {
+	errW := pack.Walk(func(obj *PackObject) {
+		objects = append(objects, obj)
+	}, func(offset int64, errS error) {
+		err = errS
+	})
+
+	if errW != nil {
+		err = errW
+	}
+
+	return
+}
+
+func treeContent(t *testing.T, modeNamesAndHashes ...string) []byte {
+	var buf bytes.Buffer
+
+	for i := 0; i < len(modeNamesAndHashes); i += 2 {
+		hash, err := hex.DecodeString(modeNamesAndHashes[i+1])
+		require.NoError(t, err)
+
+		buf.WriteString(modeNamesAndHashes[i] + "\x00")
+		buf.Write(hash)
+	}
+
+	return buf.Bytes()
+}
+
+// createDelta creates a delta that copies the whole base and inserts the rest of the target.
+func createDelta(base []byte, target []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(binary.AppendUvarint(nil, uint64(len(base))))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(target))))
+	buf.Write([]byte{0x80 | 0x10, byte(len(base))})
+	buf.WriteByte(byte(len(target) - len(base)))
+	buf.Write(target[len(base):])
+
+	return buf.Bytes()
+}
+
+func createPack(objects []packTestObject) (data []byte, offsets []int64) {
+	var buf bytes.Buffer
+	buf.Write(packMagic)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(2))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(objects)))
+
+	for _, obj := range objects {
+		offset := int64(buf.Len())
+		offsets = append(offsets, offset)
+		size := len(obj.data)
+
+		if obj.size != 0 {
+			size = obj.size
+		}
+
+		c := byte(obj.typ<<4) | byte(size&0x0f)
+		size >>= 4
+
+		for size > 0 {
+			buf.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+			size >>= 7
+		}
+
+		buf.WriteByte(c)
+
+		switch obj.typ {
+		case packTypeOfsDelta:
+			rel := offset - offsets[obj.baseIdx]
+			enc := []byte{byte(rel & 0x7f)}
+
+			for rel >>= 7; rel > 0; rel >>= 7 {
+				rel--
+				enc = append([]byte{byte(0x80 | rel&0x7f)}, enc...)
+			}
+
+			buf.Write(enc)
+		case packTypeRefDelta:
+			hash, _ := hex.DecodeString(obj.baseHash)
+			buf.Write(hash)
+		}
+
+		buf.Write(CompressGitObject(obj.data))
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+
+	return buf.Bytes(), offsets
+}
+
+func createPackIndex(hashes []string, offsets []int64, packData []byte) []byte {
+	order := make([]int, len(hashes))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(a, b int) bool { return hashes[order[a]] < hashes[order[b]] })
+
+	var buf bytes.Buffer
+	buf.Write(packIdxMagic)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(packIdxVersion))
+
+	var fanout [256]uint32
+
+	for _, hash := range hashes {
+		first, _ := hex.DecodeString(hash[:2])
+
+		for i := int(first[0]); i < 256; i++ {
+			fanout[i]++
+		}
+	}
+
+	_ = binary.Write(&buf, binary.BigEndian, fanout)
+
+	for _, i := range order {
+		hash, _ := hex.DecodeString(hashes[i])
+		buf.Write(hash)
+	}
+
+	buf.Write(make([]byte, 4*len(hashes))) // CRC32 is not verified
+
+	for _, i := range order {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(offsets[i]))
+	}
+
+	buf.Write(packData[len(packData)-sha1.Size:])
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+
+	return buf.Bytes()
+}
@@ -0,0 +1,264 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	FilePaths         = ".gitrip-paths.jsonl"
+	MaxPathsPerObject = 10 // the same blob can be in many directories and commits
+)
+
+// Base names of files worth fetching before other objects.
+var interestingNames = []string{
+	".env", ".env.*", "*.env", ".git-credentials", ".htpasswd", ".npmrc", ".pypirc", ".netrc", ".pgpass",
+	"wp-config.php", "config.php", "configuration.php", "settings.php", "settings.py", "local_settings.py",
+	"database.yml", "secrets.yml", "credentials*", "appsettings*.json", "application*.properties", "application*.yml",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "*.pem", "*.key", "*.p12", "*.pfx", "*.kdbx",
+	".gitmodules", "*.sql", "*.sql.gz", "*.sqlite", "*.sqlite3", "*.db", "docker-compose*.yml", "terraform.tfstate*", "*.tfvars",
+}
+
+// PathMap maps object hashes to their file paths using tree entries discovered during the crawl.
+// Trees can arrive in any order, so only the links to parent trees are stored and paths are resolved on demand.
+// Paths of trees without a known parent are relative to that tree.
+type PathMap struct {
+	mu      sync.Mutex
+	parents map[string][]treeLink // object hash -> trees containing it
+	trees   map[string]bool
+}
+
+type treeLink struct {
+	tree string
+	name string
+	mode string
+}
+
+// PathRecord is one line of the paths file.
+type PathRecord struct {
+	Hash  string   `json:"hash"`
+	Mode  string   `json:"mode"`
+	Paths []string `json:"paths"`
+}
+
+func NewPathMap() *PathMap {
+	return &PathMap{
+		parents: make(map[string][]treeLink),
+		trees:   make(map[string]bool),
+	}
+}
+
+func (pm *PathMap) AddTree(hash string, entries []TreeEntry) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.trees[hash] {
+		return
+	}
+
+	pm.trees[hash] = true
+
+	for _, e := range entries {
+		pm.parents[e.Hash] = append(pm.parents[e.Hash], treeLink{tree: hash, name: e.Name, mode: e.Mode})
+	}
+}
+
+func (pm *PathMap) Len() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	return len(pm.parents)
+}
+
+// Paths returns up to MaxPathsPerObject paths of the object.
+func (pm *PathMap) Paths(hash string) []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	return pm.paths(hash, make(map[string][]string))
+}
+
+func (pm *PathMap) paths(hash string, memo map[string][]string) (paths []string) {
+	if cached, ok := memo[hash]; ok {
+		return cached
+	}
+
+	memo[hash] = nil // Guards against cycles in corrupted data.
+	links := pm.parents[hash]
+
+	if len(links) == 0 && pm.trees[hash] {
+		paths = []string{""}
+	}
+
+	for _, link := range links {
+		for _, parent := range pm.paths(link.tree, memo) {
+			if len(paths) >= MaxPathsPerObject {
+				break
+			}
+
+			if p := path.Join(parent, link.name); !containsString(paths, p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	memo[hash] = paths
+
+	return
+}
+
+// Records returns paths of all files, symlinks and gitlinks, sorted by the first path and hash.
+func (pm *PathMap) Records() (records []PathRecord) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	memo := make(map[string][]string)
+
+	for hash, links := range pm.parents {
+		if links[0].mode == ModeTree {
+			continue
+		}
+
+		if paths := pm.paths(hash, memo); len(paths) > 0 {
+			records = append(records, PathRecord{Hash: hash, Mode: links[0].mode, Paths: paths})
+		}
+	}
+
+	sortPathRecords(records)
+
+	return
+}
+
+func sortPathRecords(records []PathRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Paths[0] != records[j].Paths[0] {
+			return records[i].Paths[0] < records[j].Paths[0]
+		}
+
+		return records[i].Hash < records[j].Hash
+	})
+}
+
+// Save merges the records with the file of a previous run, an update may not see all the trees again.
+func (pm *PathMap) Save(file string) (cnt int, err error) {
+	records := pm.Records()
+
+	if data, errR := os.ReadFile(file); errR == nil {
+		records = mergePathRecords(loadPathRecords(data), records)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for _, rec := range records {
+		if err = enc.Encode(rec); err != nil {
+			return
+		}
+	}
+
+	return len(records), os.WriteFile(file, buf.Bytes(), FilePerm)
+}
+
+func loadPathRecords(data []byte) (records []PathRecord) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+
+	for scanner.Scan() {
+		var rec PathRecord
+
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.Hash != "" && len(rec.Paths) > 0 {
+			records = append(records, rec)
+		}
+	}
+
+	return
+}
+
+// mergePathRecords adds the saved paths after the current ones, up to MaxPathsPerObject.
+func mergePathRecords(saved []PathRecord, current []PathRecord) (records []PathRecord) {
+	byHash := make(map[string]int, len(saved)+len(current))
+
+	for _, rec := range append(current, saved...) {
+		i, ok := byHash[rec.Hash]
+
+		if !ok {
+			byHash[rec.Hash] = len(records)
+			records = append(records, PathRecord{Hash: rec.Hash, Mode: rec.Mode})
+			i = len(records) - 1
+		}
+
+		for _, p := range rec.Paths {
+			if len(records[i].Paths) < MaxPathsPerObject && !containsString(records[i].Paths, p) {
+				records[i].Paths = append(records[i].Paths, p)
+			}
+		}
+	}
+
+	sortPathRecords(records)
+
+	return
+}
+
+func isInterestingName(name string) bool {
+	base := strings.ToLower(path.Base(name))
+
+	for _, pattern := range interestingNames {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rp *Repo) pathsFile() string {
+	return filepath.Join(rp.metaDir, FilePaths)
+}
+
+// addTrees records tree entries and queues interesting files before other objects.
+func (rp *Repo) addTrees(item *Item) {
+	for hash, entries := range item.trees {
+		rp.paths.AddTree(hash, entries)
+
+		for _, e := range entries {
+			if e.Mode == ModeTree || e.Mode == ModeGitlink || !isInterestingName(e.Name) {
+				continue
+			}
+
+			if path, err := HashToPath(rp.objectFormat().Regexp, e.Hash); err == nil && rp.addPathPriority(path, priorityInteresting) {
+				rp.out.Debugf("(%s) interesting file %s queued first", rp.Url, e.Name)
+			}
+		}
+	}
+}
+
+func (rp *Repo) savePaths() {
+	if rp.paths.Len() == 0 {
+		return
+	}
+
+	cnt, err := rp.paths.Save(rp.pathsFile())
+
+	if err != nil {
+		rp.logf("saving paths: %v", err)
+	} else {
+		rp.logf("paths of %d files saved into %s", cnt, rp.pathsFile())
+	}
+}
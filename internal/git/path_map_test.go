@@ -0,0 +1,86 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathMap(t *testing.T) {
+	root := "1111111111111111111111111111111111111111"
+	oldRoot := "2222222222222222222222222222222222222222"
+	config := "3333333333333333333333333333333333333333"
+	env := "4444444444444444444444444444444444444444"
+	module := "5555555555555555555555555555555555555555"
+
+	pm := NewPathMap()
+
+	// Subtree arrives before the roots.
+	pm.AddTree(config, []TreeEntry{{Mode: "100644", Name: ".env", Hash: env}})
+	pm.AddTree(root, []TreeEntry{
+		{Mode: ModeTree, Name: "config", Hash: config},
+		{Mode: ModeGitlink, Name: "vendor/lib", Hash: module},
+	})
+	pm.AddTree(oldRoot, []TreeEntry{{Mode: ModeTree, Name: "conf", Hash: config}})
+
+	assert.ElementsMatch(t, []string{"config/.env", "conf/.env"}, pm.Paths(env))
+	assert.Equal(t, []string{"vendor/lib"}, pm.Paths(module))
+	assert.Equal(t, []string{""}, pm.Paths(root))
+	assert.Empty(t, pm.Paths("6666666666666666666666666666666666666666"))
+
+	records := pm.Records()
+	assert.Len(t, records, 2)
+	assert.Equal(t, env, records[0].Hash)
+	assert.Equal(t, ModeGitlink, records[1].Mode)
+}
+
+func TestIsInterestingName(t *testing.T) {
+	for _, name := range []string{".env", "app/.env.production", "wp-config.php", "backup/DUMP.SQL", "keys/id_rsa"} {
+		assert.True(t, isInterestingName(name), name)
+	}
+
+	for _, name := range []string{"README.md", "src/env.go", "config.php.dist.txt"} {
+		assert.False(t, isInterestingName(name), name)
+	}
+}
+
+func TestPathMapSaveMerges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), FilePaths)
+	shared := "3333333333333333333333333333333333333333"
+
+	first := NewPathMap()
+	first.AddTree("1111111111111111111111111111111111111111", []TreeEntry{
+		{Mode: "100644", Name: "a.txt", Hash: "4444444444444444444444444444444444444444"},
+		{Mode: "100644", Name: "shared.txt", Hash: shared},
+	})
+
+	cnt, err := first.Save(file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cnt)
+
+	second := NewPathMap()
+	second.AddTree("2222222222222222222222222222222222222222", []TreeEntry{
+		{Mode: "100644", Name: "b.txt", Hash: "5555555555555555555555555555555555555555"},
+		{Mode: "100644", Name: "moved.txt", Hash: shared},
+	})
+
+	cnt, err = second.Save(file)
+	require.NoError(t, err)
+	assert.Equal(t, 3, cnt)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	paths := make(map[string][]string)
+
+	for _, rec := range loadPathRecords(data) {
+		paths[rec.Hash] = rec.Paths
+	}
+
+	assert.Equal(t, []string{"a.txt"}, paths["4444444444444444444444444444444444444444"])
+	assert.Equal(t, []string{"b.txt"}, paths["5555555555555555555555555555555555555555"])
+	assert.Equal(t, []string{"moved.txt", "shared.txt"}, paths[shared])
+}
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+func TestRecords(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, PathRoot)
+	blob := writeLooseObject(t, gitDir, ObjectBlob, []byte("SECRET=1\n"))
+	tree := writeLooseObject(t, gitDir, ObjectTree, treeContent(t, "100644 .env", blob))
+	commit := writeLooseObject(t, gitDir, ObjectCommit, []byte("tree "+tree+"\n"+
+		"author A <a@unsecured.company> 1700000000 +0000\ncommitter A <a@unsecured.company> 1700000000 +0000\n\ninit\n"))
+
+	writeTestFile(t, gitDir, PathHead, []byte("ref: refs/heads/main\n"))
+	writeTestFile(t, gitDir, "refs/heads/main", []byte(commit+"\n"))
+	writeTestFile(t, gitDir, PathConfig, []byte("[core]\n\trepositoryformatversion = 0\n"))
+	writeTestFile(t, gitDir, PathIndex, createIndex(FormatSHA1, 2, []string{".env"}, []string{blob}))
+
+	var configRequests atomic.Int32
+	files := http.FileServer(http.Dir(root))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+PathRoot+"/"+PathConfig {
+			configRequests.Add(1)
+		}
+
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	dwnDir := t.TempDir()
+
+	t.Run("check", func(t *testing.T) {
+		app, stdout, stderr := createApp(t, application.CmdCheck, server.URL, "--format", application.FormatJsonl)
+		require.NoError(t, NewChecker(app).Run())
+		app.Out.Flush()
+
+		records := decodeJsonl[CheckResult](t, stdout.String())
+		require.Len(t, records, 1)
+		assert.Equal(t, server.URL+"/"+PathRoot, records[0].Url)
+		assert.Equal(t, http.StatusOK, records[0].StatusCode)
+		assert.Equal(t, 1, records[0].Entries)
+		assert.Equal(t, FormatNameSHA1, records[0].ObjectFormat)
+		assert.Empty(t, records[0].Error)
+		assert.NotEmpty(t, stderr.String())
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		app, stdout, stderr := createApp(t, application.CmdFetch, server.URL, "--format", application.FormatJson)
+		app.Cfg.DwnDir = dwnDir
+		configRequests.Store(0)
+		require.NoError(t, NewDumper(app).Run())
+		app.Out.Flush()
+
+		var records []FetchResult
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &records), stdout.String())
+		require.Len(t, records, 1)
+		assert.Equal(t, server.URL+"/"+PathRoot, records[0].Url)
+		assert.Equal(t, 1, records[0].Commits)
+		assert.Equal(t, 3, records[0].ObjectsValid)
+		assert.GreaterOrEqual(t, records[0].FilesSaved, 7)
+		assert.Empty(t, records[0].Error)
+		assert.FileExists(t, filepath.Join(records[0].Dir, "objects", blob[:2], blob[2:]))
+		assert.FileExists(t, filepath.Join(records[0].Dir, PathConfig))
+		assert.Equal(t, int32(1), configRequests.Load())
+		assert.Contains(t, stderr.String(), "done with")
+	})
+
+	t.Run("index", func(t *testing.T) {
+		app, stdout, stderr := createApp(t, application.CmdIndex, filepath.Join(gitDir, PathIndex), "--format", application.FormatJsonl)
+		require.NoError(t, RunIndexDump(app))
+		app.Out.Flush()
+
+		records := decodeJsonl[IndexEntryRecord](t, stdout.String())
+		require.Len(t, records, 1)
+		assert.Equal(t, ".env", records[0].Name)
+		assert.Equal(t, blob, records[0].Hash)
+		assert.Equal(t, "0100644", records[0].Mode)
+		assert.NotEmpty(t, stderr.String())
+	})
+}
+
+// createApp parses the command line as main does, stdout and stderr are captured.
+func createApp(t *testing.T, args ...string) (app *application.App, stdout *bytes.Buffer, stderr *bytes.Buffer) {
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	out := application.NewOutput()
+	out.SetWriters(stdout, stderr)
+
+	cfg, mErr := application.NewConfig(append([]string{"gitrip"}, args...), out)
+	require.False(t, mErr.HasErrors(), mErr.Errs)
+
+	return &application.App{Cfg: cfg, Out: out, Ctx: context.Background()}, stdout, stderr
+}
+
+func decodeJsonl[T any](t *testing.T, data string) (records []T) {
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var record T
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+
+	return
+}
+
+func writeTestFile(t *testing.T, gitDir string, path string, data []byte) {
+	file := filepath.Join(gitDir, filepath.FromSlash(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), DirPerm))
+	require.NoError(t, os.WriteFile(file, data, FilePerm))
+}
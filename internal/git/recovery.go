@@ -0,0 +1,75 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+const (
+	StatusRecovered = "recovered"
+	StatusMissing   = "missing"
+	StatusCorrupt   = "corrupt"
+)
+
+var recoveryStatuses = []string{StatusRecovered, StatusMissing, StatusCorrupt}
+
+// Recovery tells which .git/index entries have their blob in the dump.
+type Recovery struct {
+	Statuses map[string]string // index entry name -> status
+	Counts   map[string]int
+	Sizes    map[string]int64
+}
+
+func NewRecovery(idx *Index, store *ObjectStore) (rec *Recovery) {
+	rec = &Recovery{
+		Statuses: make(map[string]string, len(idx.Entries)),
+		Counts:   make(map[string]int),
+		Sizes:    make(map[string]int64),
+	}
+
+	for _, e := range idx.Entries {
+		status := StatusRecovered
+		_, _, err := store.Object(e.Hash)
+
+		if errors.Is(err, ErrObjectCorrupt) {
+			status = StatusCorrupt
+		} else if err != nil {
+			status = StatusMissing
+		}
+
+		rec.Statuses[e.Name] = status
+		rec.Counts[status]++
+		rec.Sizes[status] += int64(e.Size)
+	}
+
+	return
+}
+
+func NewRecoveryFromDir(gitDir string) (rec *Recovery, err error) {
+	idx, err := NewIndexFromFile(filepath.Join(gitDir, PathIndex))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading index file: %w", err)
+	}
+
+	store, err := NewObjectStore(gitDir)
+	defer store.Close()
+
+	return NewRecovery(idx, store), err
+}
+
+func (rec *Recovery) Summary() (summary string) {
+	for i, status := range recoveryStatuses {
+		if i > 0 {
+			summary += ", "
+		}
+
+		size := utils.SizeToHumanReadable(rec.Sizes[status])
+		summary += fmt.Sprintf("%s %s (%s)", status, utils.NumToUnderscores(rec.Counts[status]), size)
+	}
+
+	return
+}
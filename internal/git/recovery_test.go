@@ -0,0 +1,43 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryFromDir(t *testing.T) {
+	gitDir := t.TempDir()
+	recovered := writeLooseObject(t, gitDir, ObjectBlob, []byte("recovered\n"))
+	corrupt := writeLooseObject(t, gitDir, ObjectBlob, []byte("corrupt\n"))
+	corruptPath, _ := HashToPath(regexp.MustCompile(HashRegexp), corrupt)
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, corruptPath), CompressGitObject([]byte("blob 3\x00bad")), FilePerm))
+
+	idx := &index.Index{Version: 2, Entries: []*index.Entry{
+		{Name: "corrupt.txt", Hash: plumbing.NewHash(corrupt), Size: 8},
+		{Name: "missing.txt", Hash: plumbing.NewHash("1e123d74161cd70f3bf678c2142034db220ada91"), Size: 100},
+		{Name: "recovered.txt", Hash: plumbing.NewHash(recovered), Size: 10},
+	}}
+
+	file, err := os.Create(filepath.Join(gitDir, PathIndex))
+	require.NoError(t, err)
+	require.NoError(t, index.NewEncoder(file).Encode(idx))
+	require.NoError(t, file.Close())
+
+	rec, err := NewRecoveryFromDir(gitDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"corrupt.txt":   StatusCorrupt,
+		"missing.txt":   StatusMissing,
+		"recovered.txt": StatusRecovered,
+	}, rec.Statuses)
+	assert.Equal(t, int64(100), rec.Sizes[StatusMissing])
+	assert.Equal(t, "recovered 1 (10.00 B), missing 1 (100.00 B), corrupt 1 (8.00 B)", rec.Summary())
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	PathFetchHead = "FETCH_HEAD"
+	PathConfig    = "config"
+	PathPrefixLog = "logs/"
+)
+
+var (
+	DefaultBranches = []string{"master", "main"}
+	DefaultRemotes  = []string{"origin"}
+
+	regexpRefName        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	regexpReflogCheckout = regexp.MustCompile(`checkout: moving from (\S+) to (\S+)`)
+	regexpFetchHead      = regexp.MustCompile(`(branch|tag) '([^']+)' of `)
+	regexpConfigSection  = regexp.MustCompile(`^\[(branch|remote) "([^"]+)"\]$`)
+	regexpConfigMerge    = regexp.MustCompile(`^merge\s*=\s*refs/heads/(\S+)$`)
+)
+
+// RefNames collects branch, remote and tag names discovered during the crawl.
+// Every new name is combined with already known names into paths of refs and reflogs.
+type RefNames struct {
+	mu       sync.Mutex
+	branches map[string]bool
+	remotes  map[string]bool
+	tags     map[string]bool
+}
+
+func NewRefNames() *RefNames {
+	return &RefNames{
+		mu:       sync.Mutex{},
+		branches: make(map[string]bool),
+		remotes:  make(map[string]bool),
+		tags:     make(map[string]bool),
+	}
+}
+
+// Add returns paths for names which were not known yet.
+func (rn *RefNames) Add(branches []string, remotes []string, tags []string) (paths map[string]bool) {
+	paths = make(map[string]bool)
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	for _, remote := range remotes {
+		if rn.remotes[remote] || !isValidRefName(remote) {
+			continue
+		}
+
+		rn.remotes[remote] = true
+		addRefPaths(paths, "refs/remotes/"+remote+"/HEAD")
+
+		for branch := range rn.branches {
+			addRefPaths(paths, "refs/remotes/"+remote+"/"+branch)
+		}
+	}
+
+	for _, branch := range branches {
+		if rn.branches[branch] || !isValidRefName(branch) {
+			continue
+		}
+
+		rn.branches[branch] = true
+		addRefPaths(paths, "refs/heads/"+branch)
+
+		for remote := range rn.remotes {
+			addRefPaths(paths, "refs/remotes/"+remote+"/"+branch)
+		}
+	}
+
+	for _, tag := range tags {
+		if rn.tags[tag] || !isValidRefName(tag) {
+			continue
+		}
+
+		rn.tags[tag] = true
+		paths["refs/tags/"+tag] = true
+	}
+
+	return
+}
+
+func addRefPaths(paths map[string]bool, ref string) {
+	paths[ref] = true
+	paths[PathPrefixLog+ref] = true
+}
+
+// isValidRefName is stricter than git itself, names end up in URLs and in paths on disk.
+func isValidRefName(name string) bool {
+	return regexpRefName.MatchString(name) &&
+		!strings.Contains(name, "..") &&
+		!strings.HasSuffix(name, "/") &&
+		!strings.HasSuffix(name, ".lock")
+}
+
+// branchesFromReflog returns branch names from "checkout: moving from X to Y" lines.
+func branchesFromReflog(data string) (branches []string) {
+	for _, match := range regexpReflogCheckout.FindAllStringSubmatch(data, -1) {
+		for _, name := range match[1:] {
+			if !isHash(name) {
+				branches = append(branches, name)
+			}
+		}
+	}
+
+	return
+}
+
+// refsFromFetchHead returns names from "branch 'X' of URL" and "tag 'Y' of URL" lines.
+func refsFromFetchHead(data string) (branches []string, tags []string) {
+	for _, match := range regexpFetchHead.FindAllStringSubmatch(data, -1) {
+		if match[1] == "tag" {
+			tags = append(tags, match[2])
+		} else {
+			branches = append(branches, match[2])
+		}
+	}
+
+	return
+}
+
+// refsFromConfig returns names from [branch "X"] and [remote "Y"] sections and branch merge settings.
+func refsFromConfig(data string) (branches []string, remotes []string) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := regexpConfigSection.FindStringSubmatch(line); match != nil {
+			if match[1] == "remote" {
+				remotes = append(remotes, match[2])
+			} else {
+				branches = append(branches, match[2])
+			}
+		} else if match := regexpConfigMerge.FindStringSubmatch(line); match != nil {
+			branches = append(branches, match[1])
+		}
+	}
+
+	return
+}
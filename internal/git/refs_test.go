@@ -0,0 +1,68 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefNamesFromFiles(t *testing.T) {
+	reflog := "0000000000000000000000000000000000000000 2b9c3f3aae0c83775239dc2b04301d833382a497 Unsecured Company " +
+		"<git@unsecured.company> 1742629735 +0100	checkout: moving from master to feature/login\n" +
+		"2b9c3f3aae0c83775239dc2b04301d833382a497 2b9c3f3aae0c83775239dc2b04301d833382a497 Unsecured Company " +
+		"<git@unsecured.company> 1742629735 +0100	checkout: moving from 2b9c3f3aae0c83775239dc2b04301d833382a497 to develop\n"
+
+	fetchHead := "652c5d72790ba74bd7b83f8b2a63bc942c2c304d		branch 'main' of https://unsecured.company/repo\n" +
+		"34a8743de4384dc08f736eee2f35b0528e6a1321	not-for-merge	branch 'release/1.2' of https://unsecured.company/repo\n" +
+		"01e5743765655a7a5fab26356652c5d72790ba74	not-for-merge	tag 'v1.2.0' of https://unsecured.company/repo\n"
+
+	config := `[core]
+	bare = false
+[remote "upstream"]
+	url = https://unsecured.company/repo
+	fetch = +refs/heads/*:refs/remotes/upstream/*
+[branch "staging"]
+	remote = upstream
+	merge = refs/heads/production
+`
+
+	item := createItem("logs/HEAD", reflog, false)
+	_, err := item.GetPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"master", "feature/login", "develop"}, item.branches)
+
+	item = createItem(PathFetchHead, fetchHead, false)
+	_, err = item.GetPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main", "release/1.2"}, item.branches)
+	assert.Equal(t, []string{"v1.2.0"}, item.tagNames)
+
+	item = createItem(PathConfig, config, false)
+	_, err = item.GetPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"staging", "production"}, item.branches)
+	assert.Equal(t, []string{"upstream"}, item.remotes)
+}
+
+func TestRefNamesAdd(t *testing.T) {
+	rn := NewRefNames()
+
+	paths := rn.Add([]string{"develop", "../../etc/passwd"}, []string{"origin"}, []string{"v1"})
+	assert.Equal(t, map[string]bool{
+		"refs/heads/develop":               true,
+		"logs/refs/heads/develop":          true,
+		"refs/remotes/origin/HEAD":         true,
+		"logs/refs/remotes/origin/HEAD":    true,
+		"refs/remotes/origin/develop":      true,
+		"logs/refs/remotes/origin/develop": true,
+		"refs/tags/v1":                     true,
+	}, paths)
+
+	paths = rn.Add(nil, []string{"origin", "upstream"}, nil)
+	assert.Equal(t, map[string]bool{
+		"refs/remotes/upstream/HEAD":         true,
+		"logs/refs/remotes/upstream/HEAD":    true,
+		"refs/remotes/upstream/develop":      true,
+		"logs/refs/remotes/upstream/develop": true,
+	}, paths)
+}
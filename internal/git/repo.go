@@ -2,19 +2,22 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/unsecured-company/gitrip/internal/application"
+	"github.com/unsecured-company/gitrip/internal/network"
 	"github.com/unsecured-company/gitrip/internal/utils"
 )
 
@@ -24,39 +27,106 @@ const (
 	ThresholdWrongObjectsPct = 50
 	ThresholdWrongObjectsCnt = 200
 	ProgressEveryXSec        = 2
+	FileQueueState           = ".gitrip-queue.json"
+	DirTmp                   = ".gitrip-tmp" // downloads in progress, next to the .git directory
+	SuffixPart               = ".part"       // partial pack download, resumed by the next run with --update
 )
 
+var ErrRepoSizeLimit = errors.New("repository size limit reached")
+
 type Repo struct {
+	ctx               context.Context
 	dumper            *Dumper
 	cfg               *application.Config
 	out               *application.Output
 	Url               *url.URL
+	requestedUrl      string
+	parent            *Repo // set for submodules
+	depth             int   // nesting of submodules, 0 for the top repository
+	aliasOf           string
 	Dir               string
+	metaDir           string // queue state, commits and paths, outside of the .git directory
 	FilesQueue        *FetchQueue
 	wgFetcher         sync.WaitGroup
 	wgFetch           sync.WaitGroup
 	wgFileProcess     sync.WaitGroup
+	wgSave            sync.WaitGroup
 	finished          atomic.Bool
 	objectFilesCntAll atomic.Uint32
 	objectFilesCntBad atomic.Uint32
+	objectFilesCntOk  atomic.Uint32
 	objectFilesSkip   bool
-	regexpHash        *regexp.Regexp
+	cntSaved          atomic.Uint32
+	cntRejected       atomic.Uint32
+	stalled           *utils.SafeMapStrings // path -> error of downloads which stalled or were too slow
+	notFound          *NotFoundBaseline
+	configItem        *Item // fetched before the queue starts
+	bytesSaved        atomic.Int64
+	bytesFetched      atomic.Int64
+	sizeLimitOnce     sync.Once
+	tmpDir            string
+	started           time.Time
+	format            atomic.Pointer[ObjectFormat]
+	packedObjects     *utils.SafeMapStrings
+	refNames          *RefNames
+	commits           *CommitLog
+	paths             *PathMap
+	submodules        *utils.SafeMapStrings // name -> path
+	gitlinks          *utils.SafeMapStrings // paths of submodules without known name
+	submoduleResults  []*FetchResult
 }
 
 func NewRepo(dumper *Dumper, urlP *url.URL) (rp *Repo) {
 	utils.AddUrlSuffix(urlP, PathRoot)
 
-	return &Repo{
-		dumper:     dumper,
-		cfg:        dumper.app.Cfg,
-		out:        dumper.app.Out,
-		Url:        urlP,
-		FilesQueue: NewFetchQueue(),
-		regexpHash: regexp.MustCompile(HashRegexp),
+	return newRepo(dumper, urlP)
+}
+
+// newRepo takes the URL of the git directory as it is.
+func newRepo(dumper *Dumper, urlP *url.URL) (rp *Repo) {
+	rp = &Repo{
+		ctx:           dumper.app.Ctx,
+		dumper:        dumper,
+		cfg:           dumper.app.Cfg,
+		out:           dumper.app.Out,
+		Url:           urlP,
+		requestedUrl:  urlP.String(),
+		FilesQueue:    NewFetchQueue(dumper.app.Ctx),
+		packedObjects: utils.NewSafeMapStrings(),
+		refNames:      NewRefNames(),
+		commits:       NewCommitLog(),
+		paths:         NewPathMap(),
+		submodules:    utils.NewSafeMapStrings(),
+		gitlinks:      utils.NewSafeMapStrings(),
+		stalled:       utils.NewSafeMapStrings(),
 	}
+
+	rp.format.Store(FormatSHA1)
+
+	return
+}
+
+// FetchResult is the record for one fetched repository in json and jsonl format.
+type FetchResult struct {
+	Url            string         `json:"url"`
+	FinalUrl       string         `json:"final_url"`
+	AliasOf        string         `json:"alias_of,omitempty"`
+	Dir            string         `json:"dir"`
+	Requests       int            `json:"requests"`
+	FilesSaved     int            `json:"files_saved"`
+	FilesRejected  int            `json:"files_rejected"`
+	FilesStalled   []string       `json:"files_stalled,omitempty"`
+	ObjectsValid   int            `json:"objects_valid"`
+	ObjectsInvalid int            `json:"objects_invalid"`
+	Commits        int            `json:"commits"`
+	Bytes          int64          `json:"bytes"`
+	DurationMs     int64          `json:"duration_ms"`
+	Submodules     []*FetchResult `json:"submodules,omitempty"`
+	Error          string         `json:"error,omitempty"`
 }
 
 func (rp *Repo) Run() (err error) {
+	rp.started = time.Now()
 	rp.out.Logf("(%s) Starting", rp.Url.String())
 	indexItem, err := rp.detectAndStart()
 
@@ -64,30 +134,159 @@ func (rp *Repo) Run() (err error) {
 		return
 	}
 
-	rp.out.Debugf("Starting %d fetchers", rp.cfg.DwnThreads)
-	for i := rp.cfg.DwnThreads; i > 0; i-- {
+	rp.tmpDir = filepath.Join(rp.metaDir, DirTmp)
+
+	if err = os.MkdirAll(rp.tmpDir, DirPerm); err != nil {
+		return
+	}
+
+	defer rp.removeTmpDir()
+
+	// Each repository can use the whole budget, the scheduler shares it.
+	rp.out.Debugf("Starting %d fetchers", rp.cfg.Workers)
+	for i := rp.cfg.Workers; i > 0; i-- {
 		rp.wgFetcher.Add(1)
 		go rp.runnerFetch(i)
 	}
 
 	go rp.progressPrinter()
+
+	rp.FilesQueue.Begin() // Fetchers run while the initial paths are added.
+
+	if rp.cfg.Update {
+		rp.loadState()
+		rp.loadSubmodules()
+	}
+
+	rp.processConfig()
 	rp.addPaths(getPathsCommon())
+	rp.addPaths(rp.refNames.Add(DefaultBranches, DefaultRemotes, nil))
 
 	paths, err := indexItem.getPathFromIndexFile()
 
 	if err == nil {
 		rp.addPaths(paths)
-		rp.logf("%s files in GIT Index file", utils.NumToUnderscores(len(paths)))
+		rp.addSubmodules(indexItem.submodules)
+		rp.logf("%s files, %s extension objects in GIT Index file",
+			utils.NumToUnderscores(indexItem.indexFiles), utils.NumToUnderscores(indexItem.indexExtObjs))
 	}
 
+	rp.FilesQueue.End()
+
 	rp.out.Debugf("(%s) Waiting", rp.Url)
 	rp.Wait()
 	rp.finished.Store(true)
+
+	if rp.ctx.Err() != nil {
+		rp.wgSave.Wait()
+		rp.saveState()
+		rp.saveCommits()
+		rp.savePaths()
+
+		return fmt.Errorf("interrupted after %d items, run with --update to continue", rp.FilesQueue.CntDone())
+	}
+
 	rp.logf("done with %d items", rp.FilesQueue.CntDone())
 
+	if stalled := rp.stalledPaths(); len(stalled) > 0 {
+		rp.logf("%d files stalled or were too slow: %s", len(stalled), strings.Join(stalled, ", "))
+	}
+
+	if rp.cfg.Recovery {
+		rp.logRecovery()
+	}
+
+	rp.saveCommits()
+	rp.savePaths()
+	_ = os.Remove(rp.stateFile())
+	rp.runSubmodules()
+
+	return nil
+}
+
+func (rp *Repo) stalledPaths() []string {
+	return slices.Sorted(slices.Values(rp.stalled.Keys()))
+}
+
+func (rp *Repo) Result(err error) (res *FetchResult) {
+	res = &FetchResult{
+		Url:            rp.requestedUrl,
+		FinalUrl:       rp.Url.String(),
+		AliasOf:        rp.aliasOf,
+		Dir:            rp.Dir,
+		Requests:       rp.FilesQueue.CntDone(),
+		FilesSaved:     int(rp.cntSaved.Load()),
+		FilesRejected:  int(rp.cntRejected.Load()),
+		FilesStalled:   rp.stalledPaths(),
+		ObjectsValid:   int(rp.objectFilesCntOk.Load()),
+		ObjectsInvalid: int(rp.objectFilesCntBad.Load()),
+		Commits:        rp.commits.Len(),
+		Bytes:          rp.bytesSaved.Load(),
+		DurationMs:     time.Since(rp.started).Milliseconds(),
+		Submodules:     rp.submoduleResults,
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
 	return
 }
 
+// stateFile is stored next to the .git directory, so it is not mixed with downloaded files.
+func (rp *Repo) stateFile() string {
+	return filepath.Join(rp.metaDir, FileQueueState)
+}
+
+func (rp *Repo) saveState() {
+	err := rp.FilesQueue.SaveState(rp.stateFile())
+
+	if err != nil {
+		rp.logf("saving queue state: %v", err)
+	} else {
+		rp.logf("queue state saved into %s", rp.stateFile())
+	}
+}
+
+func (rp *Repo) loadState() {
+	todo, err := rp.FilesQueue.LoadState(rp.stateFile())
+
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		rp.logf("loading queue state: %v", err)
+		return
+	}
+
+	rp.logf("resuming, %d paths to fetch", len(todo))
+
+	for _, path := range todo {
+		rp.addPath(path)
+	}
+}
+
+func (rp *Repo) save(item *Item) {
+	rp.cntSaved.Add(1)
+	rp.bytesSaved.Add(int64(item.fileSize))
+	rp.wgSave.Add(1)
+	item.wgSave = &rp.wgSave
+	rp.dumper.chanSave <- item
+}
+
+// logRecovery tells how many files from the index have their blob in the dump.
+func (rp *Repo) logRecovery() {
+	rp.wgSave.Wait()
+	rec, err := NewRecoveryFromDir(rp.Dir)
+
+	if rec != nil {
+		rp.logf("index %s", rec.Summary())
+	}
+
+	if err != nil {
+		rp.logf("recovery check: %v", err)
+	}
+}
+
 func (rp *Repo) setRootDir(dirBase string, urlP *url.URL) (exists bool, err error) {
 	var dir string
 	suffix := string(filepath.Separator) + PathRoot
@@ -111,17 +310,31 @@ func (rp *Repo) setRootDir(dirBase string, urlP *url.URL) (exists bool, err erro
 	}
 
 	rp.Dir = dir
+	rp.metaDir = filepath.Dir(dir)
 
 	return
 }
 
 func (rp *Repo) runnerFetch(id int) {
-	for path := range rp.FilesQueue.Todo() {
+	for {
+		path, ok := rp.FilesQueue.Next()
+
+		if !ok {
+			break
+		}
+
+		if !rp.dumper.scheduler.Acquire(rp.ctx) {
+			rp.FilesQueue.End()
+			break // Path stays queued in the saved state.
+		}
+
 		if application.DebugPrintEveryFetch {
 			rp.out.Debug(rp.logMsgf("Fetcher [%d] %s START", id, path))
 		}
 
 		_, err := rp.fetchPath(path)
+		rp.dumper.scheduler.Release()
+		rp.FilesQueue.End()
 
 		if application.DebugPrintEveryFetch {
 			rp.out.Debug(rp.logMsgf("Fetcher [%d] %s DONE - %v", id, path, err))
@@ -137,42 +350,207 @@ func (rp *Repo) fetchPath(path string) (it *Item, err error) {
 	rp.wgFetch.Add(1)
 	defer rp.wgFetch.Done()
 
-	urlItem := utils.GetNewSuffixedUrl(rp.Url, path)
-	data, httpCode, err := rp.dumper.fetcher.Fetch(rp.dumper.app.Ctx, urlItem.String(), 4)
+	maxSize, ok := rp.maxFileSize()
+
+	if !ok {
+		rp.FilesQueue.MarkDone(path)
+		return nil, ErrRepoSizeLimit
+	}
+
+	tmpFile, err := rp.createTmpFile(path)
+
+	if err != nil {
+		rp.FilesQueue.MarkDone(path)
+		return
+	}
+
+	size, httpCode, info, err := rp.fetchToFile(path, tmpFile, maxSize)
+	isResumable := strings.HasSuffix(tmpFile, SuffixPart) && !errors.Is(err, network.ErrFileTooLarge)
+
+	if rp.ctx.Err() != nil {
+		// Not marked as done, it stays in the saved state.
+		if !isResumable {
+			_ = os.Remove(tmpFile)
+		}
+
+		return nil, rp.ctx.Err()
+	}
+
 	rp.FilesQueue.MarkDone(path)
 
+	if errors.Is(err, network.ErrFileTooLarge) {
+		rp.logf("[%s] skipped, %v", path, err)
+	} else if errors.Is(err, network.ErrStalled) || errors.Is(err, network.ErrTooSlow) {
+		rp.stalled.AddKeyValue(path, err.Error())
+
+		if !isResumable {
+			rp.logf("[%s] %v", path, err)
+		}
+	}
+
+	it = NewItem(rp.Dir, path, true, rp.objectFormat(), rp.out)
+	it.UpdateFromFile(tmpFile, size, httpCode, err)
+	it.contentType = info.ContentType
+
+	if err != nil && isResumable {
+		rp.logf("[%s] %s downloaded, %v, run with --update to continue", path, utils.SizeToHumanReadable(size), err)
+		it.tmpFile = "" // Kept for the next run.
+	}
+
 	if httpCode >= 300 {
+		it.discard()
 		return nil, fmt.Errorf("Non success code")
 	}
 
-	it = NewItem(rp.Dir, path, true, rp.out)
-	it.Update(data, httpCode, err)
-
 	if it.exists {
-		rp.wgFileProcess.Add(1)
-		go rp.processFile(it)
+		err = rp.validate(it)
+	}
+
+	if !it.exists {
+		it.discard()
+		return
 	}
 
+	rp.bytesFetched.Add(size)
+	rp.wgFileProcess.Add(1)
+	rp.FilesQueue.Begin() // Processing can add paths.
+	go rp.processFile(it)
+
 	return
 }
 
+// maxFileSize is the --max-file-size limited by what remains from --max-repo-size, ok is false when nothing remains.
+func (rp *Repo) maxFileSize() (maxSize int64, ok bool) {
+	maxSize = rp.cfg.MaxFileSize
+
+	if rp.cfg.MaxRepoSize <= 0 {
+		return maxSize, true
+	}
+
+	remaining := rp.cfg.MaxRepoSize - rp.bytesFetched.Load()
+
+	if remaining <= 0 {
+		rp.sizeLimitOnce.Do(func() {
+			rp.logf("repository size limit %s reached, skipping remaining files", utils.SizeToHumanReadable(rp.cfg.MaxRepoSize))
+		})
+
+		return 0, false
+	}
+
+	if maxSize <= 0 || remaining < maxSize {
+		maxSize = remaining
+	}
+
+	return maxSize, true
+}
+
+// fetchToFile downloads the path, packs are verified by their trailer checksum as their download can be resumed.
+func (rp *Repo) fetchToFile(path string, tmpFile string, maxSize int64) (size int64, code int, info *network.ResponseInfo, err error) {
+	urlItem := utils.GetNewSuffixedUrl(rp.Url, path)
+	size, code, info, err = rp.dumper.fetcher.FetchToFile(rp.ctx, urlItem.String(), tmpFile, maxSize, 4)
+
+	if err != nil || code >= http.StatusMultipleChoices || !isPackFile(path, SuffixPack) {
+		return
+	}
+
+	if errV := verifyPackTrailer(rp.objectFormat(), tmpFile); errors.Is(errV, errPackChecksum) {
+		rp.logf("[%s] %v, downloading again", path, errV)
+
+		if err = os.Truncate(tmpFile, 0); err != nil {
+			return
+		}
+
+		size, code, info, err = rp.dumper.fetcher.FetchToFile(rp.ctx, urlItem.String(), tmpFile, maxSize, 4)
+
+		if err == nil && code < http.StatusMultipleChoices {
+			err = verifyPackTrailer(rp.objectFormat(), tmpFile)
+		}
+	}
+
+	return
+}
+
+// createTmpFile uses a stable name for packs, so the partial download is found by the next run.
+func (rp *Repo) createTmpFile(path string) (tmpFile string, err error) {
+	if isPackFile(path, SuffixPack) {
+		return filepath.Join(rp.tmpDir, filepath.Base(path)+SuffixPart), nil
+	}
+
+	file, err := os.CreateTemp(rp.tmpDir, "fetch-*")
+
+	if err != nil {
+		return
+	}
+
+	return file.Name(), file.Close()
+}
+
+// removeTmpDir keeps partial packs, the directory is removed once it is empty.
+func (rp *Repo) removeTmpDir() {
+	rp.wgSave.Wait()
+	entries, _ := os.ReadDir(rp.tmpDir)
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), SuffixPart) {
+			_ = os.Remove(filepath.Join(rp.tmpDir, entry.Name()))
+		}
+	}
+
+	_ = os.Remove(rp.tmpDir)
+}
+
 func (rp *Repo) processFile(item *Item) {
 	paths, err := rp.getPathsFromData(item)
+	rp.addPackedObjects(item)
+	rp.logTags(item)
+	rp.commits.Add(item.commits)
+	rp.addTrees(item)
 	rp.addPaths(paths)
+	rp.addRefNames(item)
+	rp.addSubmodules(item.submodules)
+	rp.setObjectFormat(item.configFormat, PathConfig)
 	rp.out.Debugf("(%s)[%d] references for [%s] [%s] (%d bytes): %v", rp.Url, item.netHttpCode, item.fileName, item.objectType, item.fileSize, paths)
 
 	if err != nil && !item.isObject {
 		rp.logf("[%s] error getting references: %v", item.fileName, err)
 	}
 
-	rp.dumper.chanSave <- item
+	rp.save(item)
+	rp.FilesQueue.End()
 	rp.wgFileProcess.Done()
 }
 
+// processConfig processes the config fetched by fetchObjectFormat like a file from the queue, it is not requested again.
+func (rp *Repo) processConfig() {
+	it := rp.configItem
+
+	if it == nil || !rp.FilesQueue.AddDone(PathConfig) {
+		return
+	}
+
+	if it.exists {
+		_ = rp.validate(it)
+	}
+
+	if !it.exists {
+		return
+	}
+
+	rp.bytesFetched.Add(int64(it.fileSize))
+	rp.wgFileProcess.Add(1)
+	rp.FilesQueue.Begin()
+	go rp.processFile(it)
+}
+
 func (rp *Repo) detectAndStart() (indexItem *Item, err error) {
-	exists, err := rp.setRootDir(rp.cfg.DwnDir, rp.Url)
-	if err == nil && exists && !rp.cfg.Update {
-		return indexItem, errors.New("directory exists and update is disabled")
+	// Submodules are placed into the directory of the parent by newSubmoduleRepo.
+	if rp.parent == nil {
+		var exists bool
+		exists, err = rp.setRootDir(rp.cfg.DwnDir, rp.Url)
+
+		if err == nil && exists && !rp.cfg.Update {
+			return indexItem, errors.New("directory exists and update is disabled")
+		}
 	}
 
 	hasIndex, indexItem, err := rp.hasIndexFile()
@@ -184,7 +562,59 @@ func (rp *Repo) detectAndStart() (indexItem *Item, err error) {
 		return
 	}
 
-	rp.dumper.chanSave <- indexItem
+	if canonical, isAlias := rp.registerRepo(indexItem); isAlias {
+		rp.aliasOf = canonical
+		return indexItem, fmt.Errorf("%w %s", ErrAlias, canonical)
+	}
+
+	rp.fetchObjectFormat()
+	rp.save(indexItem)
+	rp.bytesFetched.Add(int64(indexItem.fileSize))
+	rp.notFound = rp.dumper.notFound.Get(rp.Url, rp.fetchNotFoundBaseline)
+
+	return
+}
+
+// fetchNotFoundBaseline requests paths which can not exist, to recognise catch-all pages later.
+func (rp *Repo) fetchNotFoundBaseline() *NotFoundBaseline {
+	var probes []NotFoundResponse
+
+	for i := 0; i < notFoundProbes; i++ {
+		path := notFoundProbePath()
+		urlItem := utils.GetNewSuffixedUrl(rp.Url, path)
+		data, httpCode, info, err := rp.dumper.fetcher.FetchWithInfo(rp.ctx, urlItem.String(), 4)
+
+		if err != nil {
+			rp.out.Debugf("(%s) not found baseline: %v", rp.Url, err)
+			return nil
+		}
+
+		probes = append(probes, NotFoundResponse{Path: path, Code: httpCode, ContentType: info.ContentType, Body: data})
+	}
+
+	nf := NewNotFoundBaseline(probes...)
+
+	if nf != nil && nf.code < http.StatusMultipleChoices {
+		rp.logf("server answers %d for not existing files, these responses will be ignored", nf.code)
+	}
+
+	return nf
+}
+
+// validate rejects responses which are not the file they should be, such as soft 404 or WAF pages.
+// Files valid in the git format are kept even when they look like the not found response.
+func (rp *Repo) validate(it *Item) (err error) {
+	err = it.validate()
+
+	if err == nil && !it.hasGitFormat() && rp.notFound.Matches(it) {
+		err = fmt.Errorf("%w: %s", ErrSoftNotFound, it.fileName)
+	}
+
+	if err != nil {
+		it.exists = false
+		rp.cntRejected.Add(1)
+		rp.out.Debugf("(%s) rejected %v", rp.Url, err)
+	}
 
 	return
 }
@@ -192,16 +622,52 @@ func (rp *Repo) detectAndStart() (indexItem *Item, err error) {
 func (rp *Repo) hasIndexFile() (hasIndex bool, indexItem *Item, err error) {
 	rp.out.Debugf("(%s) checking for index file", rp.Url)
 	urlItem := utils.GetNewSuffixedUrl(rp.Url, PathIndex)
-	data, httpCode, err := rp.dumper.fetcher.Fetch(rp.dumper.app.Ctx, urlItem.String(), 4)
+	data, httpCode, info, err := rp.dumper.fetcher.FetchWithInfo(rp.ctx, urlItem.String(), 4)
 	rp.out.Debugf("(%s) check done, err: %v", rp.Url, err)
 
-	indexItem = NewItem(rp.Dir, PathIndex, true, rp.out)
+	indexItem = NewItem(rp.Dir, PathIndex, true, rp.objectFormat(), rp.out)
 	indexItem.Update(data, httpCode, err)
 	hasIndex = indexItem.IsValidIndexFile()
+	rp.setObjectFormat(indexFormat(indexItem.fileData), PathIndex)
+	indexItem.format = rp.objectFormat()
+
+	if hasIndex && len(info.Chain) > 0 {
+		rp.followRedirect(info.Chain)
+	}
 
 	return
 }
 
+// registerRepo recognises a variant of already fetched repository, e.g. http and https.
+// Submodules are part of the parent, they are not registered.
+func (rp *Repo) registerRepo(indexItem *Item) (canonical string, isAlias bool) {
+	if rp.parent != nil {
+		return
+	}
+
+	urlItem := utils.GetNewSuffixedUrl(rp.Url, PathHead)
+	head, httpCode, err := rp.dumper.fetcher.Fetch(rp.ctx, urlItem.String(), 4)
+
+	if err != nil || httpCode != http.StatusOK {
+		head = nil
+	}
+
+	return rp.dumper.dedup.Register(rp.Url, indexItem.fileData, head)
+}
+
+// followRedirect moves the repository root to where the index was redirected, other files are requested from there.
+func (rp *Repo) followRedirect(chain []string) {
+	root, ok := rootFromIndexUrl(chain[len(chain)-1])
+	urlP, err := url.Parse(root)
+
+	if !ok || err != nil || root == rp.Url.String() {
+		return
+	}
+
+	rp.logf("redirected to %s", root)
+	rp.Url = urlP
+}
+
 func (rp *Repo) addPaths(paths map[string]bool) {
 	for path, _ := range paths {
 		rp.addPath(path)
@@ -213,11 +679,18 @@ func (rp *Repo) getPathsFromData(it *Item) (paths map[string]bool, err error) {
 		return
 	}
 
+	if it.isPartial {
+		rp.logf("[%s] %s saved without looking for references, over %s", it.fileName,
+			utils.SizeToHumanReadable(int64(it.fileSize)), utils.SizeToHumanReadable(application.LimitParseSize))
+	}
+
 	paths, err = it.GetPaths()
 
 	if err != nil && it.isObject {
 		rp.objectFilesCntBad.Add(1)
 		rp.checkObjectFileSkipping()
+	} else if it.isObject {
+		rp.objectFilesCntOk.Add(1)
 	}
 
 	return
@@ -243,16 +716,55 @@ func readUntilByte(reader *bytes.Reader, delim byte) ([]byte, error) {
 	return result, nil
 }
 
+func (rp *Repo) addPackedObjects(item *Item) {
+	if len(item.packHashes) == 0 {
+		return
+	}
+
+	for _, hash := range item.packHashes {
+		if path, err := HashToPath(rp.objectFormat().Regexp, hash); err == nil {
+			rp.packedObjects.Add(path)
+		}
+	}
+
+	rp.logf("[%s] %s packed objects", item.fileName, utils.NumToUnderscores(len(item.packHashes)))
+}
+
+func (rp *Repo) addRefNames(item *Item) {
+	paths := rp.refNames.Add(item.branches, item.remotes, item.tagNames)
+
+	if len(paths) > 0 {
+		rp.out.Debugf("(%s) [%s] new refs: branches %v, remotes %v, tags %v", rp.Url, item.fileName, item.branches, item.remotes, item.tagNames)
+		rp.addPaths(paths)
+	}
+}
+
+func (rp *Repo) logTags(item *Item) {
+	for _, tag := range item.tags {
+		rp.logf("tag [%s] -> %s %s, tagger: %s, message: %q", tag.Name, tag.Type, tag.Object, tag.Tagger, tag.Message)
+	}
+}
+
 func (rp *Repo) addPath(path string) {
-	rp.FilesQueue.Add(path)
+	rp.addPathPriority(path, pathPriority(path))
+}
 
-	if isObjectFile(path) {
+func (rp *Repo) addPathPriority(path string, priority int) (added bool) {
+	if rp.packedObjects.Exists(path) {
+		return
+	}
+
+	added = rp.FilesQueue.AddPriority(path, priority)
+
+	if added && isObjectFile(path) {
 		rp.objectFilesCntAll.Add(1)
 	}
+
+	return
 }
 
 func (rp *Repo) findHashes(data []byte) (hashes []string) {
-	return rp.dumper.hashRegexp.FindAllString(string(data), -1)
+	return rp.objectFormat().Regexp.FindAllString(string(data), -1)
 }
 
 func (rp *Repo) hasItemChanCountBetween(xan chan *Item, defaultSize int) bool {
@@ -269,7 +781,7 @@ func (rp *Repo) progressPrinter() {
 		msgMem := "Mem MB allocated/total/system/garbage %v/%v/%v/%v"
 		msgMem = fmt.Sprintf(msgMem, m.Alloc/1024/1024, m.TotalAlloc/1024/1024, m.Sys/1024/1024, m.NumGC)
 
-		rp.logf("queued/done, %d/%d [%d] %s", rp.FilesQueue.CntQueued(), rp.FilesQueue.CntDone(), len(rp.FilesQueue.todo), msgMem)
+		rp.logf("queued/done, %d/%d [%d] %s", rp.FilesQueue.CntQueued(), rp.FilesQueue.CntDone(), rp.FilesQueue.CntPending(), msgMem)
 		time.Sleep(ProgressEveryXSec * time.Second)
 	}
 }
@@ -302,25 +814,9 @@ func (rp *Repo) logf(msg string, v ...interface{}) {
 	rp.out.Logf(rp.Url.String()+" "+msg, v...)
 }
 
+// Wait returns when all paths are fetched and processed, or when cancelled and the fetchers stopped.
 func (rp *Repo) Wait() {
-	for {
-		rp.wgFileProcess.Wait()
-		if rp.FilesQueue.CountersEqual() {
-			time.Sleep(time.Millisecond * 200)
-			//Trust but verify
-			rp.wgFileProcess.Wait()
-			if rp.FilesQueue.CountersEqual() {
-				break
-			}
-		}
-
-		time.Sleep(time.Millisecond * 200)
-	}
-
-	rp.FilesQueue.Close()
+	rp.FilesQueue.Wait()
 	rp.wgFetcher.Wait()
-}
-
-func isObjectFile(name string) bool {
-	return strings.HasPrefix(name, "objects/")
+	rp.wgFileProcess.Wait()
 }
@@ -0,0 +1,30 @@
+package git
+
+import "context"
+
+// Scheduler shares the --workers budget of concurrent downloads between repositories fetched in parallel.
+// Waiting fetchers get the slots in order, so a large repository does not starve the others,
+// and it can use all the slots once the others are done.
+type Scheduler struct {
+	slots chan struct{}
+}
+
+func NewScheduler(workers int) *Scheduler {
+	return &Scheduler{
+		slots: make(chan struct{}, max(1, workers)),
+	}
+}
+
+// Acquire waits for a free slot, ok is false when cancelled.
+func (s *Scheduler) Acquire(ctx context.Context) (ok bool) {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Scheduler) Release() {
+	<-s.slots
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerLimit(t *testing.T) {
+	const workers = 3
+	scheduler := NewScheduler(workers)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if !scheduler.Acquire(context.Background()) {
+				return
+			}
+
+			defer scheduler.Release()
+
+			cnt := running.Add(1)
+
+			for {
+				old := peak.Load()
+
+				if cnt <= old || peak.CompareAndSwap(old, cnt) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak.Load(), int32(workers))
+	assert.Equal(t, int32(0), running.Load())
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	scheduler := NewScheduler(1)
+	assert.True(t, scheduler.Acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan bool)
+
+	for i := 0; i < 5; i++ {
+		go func() { results <- scheduler.Acquire(ctx) }()
+	}
+
+	cancel()
+
+	for i := 0; i < 5; i++ {
+		select {
+		case ok := <-results:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("acquire is still blocked after cancel")
+		}
+	}
+
+	scheduler.Release()
+	assert.True(t, scheduler.Acquire(context.Background()))
+}
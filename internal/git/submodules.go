@@ -0,0 +1,159 @@
+package git
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	PathModules       = "modules"
+	DirModulesState   = ".gitrip-modules" // meta files of submodules, next to the meta files of the parent
+	submoduleMaxDepth = 5                 // nested submodules deeper than this are not crawled
+)
+
+var (
+	regexpConfigSubmodule = regexp.MustCompile(`^\[submodule\s+"([^"]+)"\]$`)
+	regexpConfigPath      = regexp.MustCompile(`^path\s*=\s*(.+)$`)
+)
+
+// Submodule is known by its name, which is the directory in .git/modules, and its path in the work tree.
+// Gitlinks give only the path, the name is the same unless .gitmodules says otherwise.
+type Submodule struct {
+	Name string
+	Path string
+}
+
+// submodulesFromConfig returns [submodule "X"] sections of .git/config or .gitmodules.
+func submodulesFromConfig(data string) (subs []Submodule) {
+	var current *Submodule
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			current = nil
+		}
+
+		if match := regexpConfigSubmodule.FindStringSubmatch(line); match != nil && isValidSubmoduleName(match[1]) {
+			subs = append(subs, Submodule{Name: match[1]})
+			current = &subs[len(subs)-1]
+		} else if match := regexpConfigPath.FindStringSubmatch(line); match != nil && current != nil {
+			current.Path = strings.Trim(match[1], `"`)
+		}
+	}
+
+	return
+}
+
+// isValidSubmoduleName rejects names which would leave the modules directory, as git does.
+func isValidSubmoduleName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newSubmoduleRepo crawls .git/modules/<name>/ of the parent into the same place of the dump.
+// The suffix is always appended, a nested submodule can have the name of its parent.
+func newSubmoduleRepo(parent *Repo, name string) (rp *Repo) {
+	urlP := *parent.Url
+	urlP.Path = strings.TrimRight(urlP.Path, "/") + "/" + path.Join(PathModules, name)
+	urlP.RawPath = ""
+	rp = newRepo(parent.dumper, &urlP)
+	rp.parent = parent
+	rp.depth = parent.depth + 1
+	rp.Dir = filepath.Join(parent.Dir, PathModules, filepath.FromSlash(name))
+	rp.metaDir = filepath.Join(parent.metaDir, DirModulesState, filepath.FromSlash(name))
+
+	return
+}
+
+func (rp *Repo) addSubmodules(subs []Submodule) {
+	for _, sub := range subs {
+		if sub.Name == "" {
+			rp.gitlinks.Add(sub.Path)
+		} else if path, ok := rp.submodules.Get(sub.Name); !ok || path == "" {
+			rp.out.Debugf("(%s) submodule [%s] found", rp.Url, sub.Name)
+			rp.submodules.AddKeyValue(sub.Name, sub.Path)
+		}
+	}
+}
+
+// addGitlinks adds paths of gitlink tree entries found in trees.
+func (rp *Repo) addGitlinks() {
+	for _, rec := range rp.paths.Records() {
+		if rec.Mode != ModeGitlink {
+			continue
+		}
+
+		for _, p := range rec.Paths {
+			rp.gitlinks.Add(p)
+		}
+	}
+}
+
+// submoduleNames returns sorted names of submodules, gitlinks not described by .gitmodules are named by their path.
+func (rp *Repo) submoduleNames() (names []string) {
+	rp.addGitlinks()
+	paths := make(map[string]bool)
+
+	for _, name := range rp.submodules.Keys() {
+		p, _ := rp.submodules.Get(name)
+		paths[p] = true
+		names = append(names, name)
+	}
+
+	for _, p := range rp.gitlinks.Keys() {
+		if !paths[p] && !rp.submodules.Exists(p) && isValidSubmoduleName(p) {
+			names = append(names, p)
+		}
+	}
+
+	sort.Strings(names)
+
+	return
+}
+
+// loadSubmodules finds submodules of the previous run, the config is not fetched again with --update.
+func (rp *Repo) loadSubmodules() {
+	if data, err := os.ReadFile(filepath.Join(rp.Dir, PathConfig)); err == nil {
+		rp.addSubmodules(submodulesFromConfig(string(data)))
+	}
+}
+
+// runSubmodules crawls submodules one by one after the parent is done, they share the worker budget.
+func (rp *Repo) runSubmodules() {
+	names := rp.submoduleNames()
+
+	if len(names) > 0 && rp.depth >= submoduleMaxDepth {
+		rp.logf("%d submodules not crawled, nesting depth %d reached: %s", len(names), submoduleMaxDepth, strings.Join(names, ", "))
+		return
+	}
+
+	for _, name := range names {
+		if rp.ctx.Err() != nil {
+			return
+		}
+
+		sub := newSubmoduleRepo(rp, name)
+		err := sub.Run()
+		sub.wgSave.Wait()
+
+		if err != nil {
+			rp.logf("submodule [%s]: %v", name, err)
+		}
+
+		rp.submoduleResults = append(rp.submoduleResults, sub.Result(err))
+	}
+}
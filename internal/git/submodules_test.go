@@ -0,0 +1,63 @@
+package git
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+func TestSubmodulesFromConfig(t *testing.T) {
+	gitmodules := `[submodule "vendor/payments"]
+	path = vendor/payments
+	url = git@unsecured.company:payments.git
+[submodule "theme"]
+	path = "public/themes/default"
+	url = https://unsecured.company/theme.git
+[submodule "../escape"]
+	path = escape
+`
+
+	config := `[core]
+	bare = false
+[submodule "theme"]
+	active = true
+	url = https://unsecured.company/theme.git
+[branch "main"]
+	path = not-a-submodule
+`
+
+	assert.Equal(t, []Submodule{
+		{Name: "vendor/payments", Path: "vendor/payments"},
+		{Name: "theme", Path: "public/themes/default"},
+	}, submodulesFromConfig(gitmodules))
+
+	item := createItem(PathConfig, config, false)
+	_, err := item.GetPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, []Submodule{{Name: "theme"}}, item.submodules)
+
+	assert.True(t, isValidSubmoduleName("lib/core"))
+	assert.False(t, isValidSubmoduleName("lib/../../config"))
+	assert.False(t, isValidSubmoduleName("/etc"))
+}
+
+func TestSubmoduleDepth(t *testing.T) {
+	app := &application.App{Cfg: &application.Config{}, Out: application.NewOutput(), Ctx: context.Background()}
+	urlP, _ := url.Parse("https://unsecured.company/.git/")
+	rp := newRepo(&Dumper{app: app}, urlP)
+
+	for i := 1; i <= submoduleMaxDepth; i++ {
+		rp = newSubmoduleRepo(rp, "lib")
+		assert.Equal(t, i, rp.depth)
+	}
+
+	assert.Equal(t, "https://unsecured.company/.git/modules/lib/modules/lib/modules/lib/modules/lib/modules/lib", rp.Url.String())
+
+	// Nested submodules of the deepest one are only reported.
+	rp.addSubmodules([]Submodule{{Name: "lib", Path: "lib"}})
+	rp.runSubmodules()
+	assert.Empty(t, rp.submoduleResults)
+}
@@ -0,0 +1,236 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	PathNotFoundProbe   = "gitrip-probe-" // followed by random hex, should never exist
+	objectHeaderMaxSize = 32
+	partialLoadSize     = 4096 // enough to validate the beginning of a large file
+	notFoundProbes      = 2
+	notFoundSizePercent = 5 // size tolerance of a catch-all page, on top of the difference between probes
+)
+
+var (
+	ErrInvalidContent = errors.New("invalid content")
+	ErrSoftNotFound   = errors.New("same as a not found response")
+
+	regexpRefContent = regexp.MustCompile(`^(ref: refs/\S+|[0-9a-f]{40}|[0-9a-f]{64})\r?\n?$`)
+	htmlPrefixes     = []string{"<!doctype", "<html", "<head", "<body", "<?xml"}
+)
+
+// NotFoundBaseline describes responses for paths which do not exist.
+// Catch-all servers answer every path with the same page, which may still differ in a nonce, token or time.
+// Such pages are recognised by the status, content type and size close to the probes.
+type NotFoundBaseline struct {
+	code        int
+	contentType string
+	size        int
+	tolerance   int
+}
+
+// NotFoundResponse is the response for one probe path.
+type NotFoundResponse struct {
+	Path        string
+	Code        int
+	ContentType string
+	Body        []byte
+}
+
+// NewNotFoundBaseline returns nil when the probes differ in status or content type, as they can not be told apart.
+func NewNotFoundBaseline(probes ...NotFoundResponse) *NotFoundBaseline {
+	if len(probes) == 0 {
+		return nil
+	}
+
+	nf := &NotFoundBaseline{
+		code:        probes[0].Code,
+		contentType: mediaType(probes[0].ContentType),
+	}
+
+	minSize, maxSize := -1, 0
+
+	for _, probe := range probes {
+		if probe.Code != nf.code || mediaType(probe.ContentType) != nf.contentType {
+			return nil
+		}
+
+		size := sizeWithoutEcho(len(probe.Body), probe.Body, probe.Path)
+		maxSize = max(maxSize, size)
+
+		if minSize < 0 || size < minSize {
+			minSize = size
+		}
+	}
+
+	nf.size = (minSize + maxSize) / 2
+	nf.tolerance = 2*(maxSize-minSize) + nf.size*notFoundSizePercent/100
+
+	return nf
+}
+
+// NotFoundCache keeps one baseline per host, repositories on the same host share it.
+type NotFoundCache struct {
+	mu    sync.Mutex
+	hosts map[string]*notFoundHost
+}
+
+type notFoundHost struct {
+	once     sync.Once
+	baseline *NotFoundBaseline
+}
+
+func NewNotFoundCache() *NotFoundCache {
+	return &NotFoundCache{hosts: make(map[string]*notFoundHost)}
+}
+
+// Get returns the baseline of the scheme and host of the URL, the first repository fetches it.
+func (c *NotFoundCache) Get(urlP *url.URL, fetch func() *NotFoundBaseline) *NotFoundBaseline {
+	key := urlP.Scheme + "://" + urlP.Host
+	c.mu.Lock()
+	host, found := c.hosts[key]
+
+	if !found {
+		host = &notFoundHost{}
+		c.hosts[key] = host
+	}
+
+	c.mu.Unlock()
+	host.once.Do(func() { host.baseline = fetch() })
+
+	return host.baseline
+}
+
+// notFoundProbePath returns random path to get the baseline.
+func notFoundProbePath() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return PathNotFoundProbe + hex.EncodeToString(b)
+}
+
+// Matches is true for the same status and content type with similar size, the requested path may be echoed in the page.
+// Only text pages are matched by size, a binary catch-all could drop real files of similar size.
+func (nf *NotFoundBaseline) Matches(it *Item) bool {
+	if nf == nil || it.netHttpCode != nf.code || mediaType(it.contentType) != nf.contentType {
+		return false
+	}
+
+	if nf.contentType != "text/html" && nf.contentType != "text/plain" {
+		return false
+	}
+
+	size := sizeWithoutEcho(it.fileSize, it.fileData, it.fileName)
+
+	return size >= nf.size-nf.tolerance && size <= nf.size+nf.tolerance
+}
+
+func sizeWithoutEcho(size int, body []byte, path string) int {
+	return size - bytes.Count(body, []byte(path))*len(path)
+}
+
+// mediaType drops parameters such as charset from the Content-Type.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// hasGitFormat is true for files whose content validate checks by the git format, not only for HTML.
+func (it *Item) hasGitFormat() bool {
+	return it.fileName == PathIndex || isSharedIndexFile(it.fileName) || isPackFile(it.fileName, SuffixPack) ||
+		isPackFile(it.fileName, SuffixPackIdx) || it.isObject || isRefFile(it.fileName)
+}
+
+// validate checks that the content looks like the file kind its name says.
+func (it *Item) validate() (err error) {
+	data := it.fileData
+
+	switch {
+	case it.fileName == PathIndex || isSharedIndexFile(it.fileName):
+		if !it.IsValidIndexFile() {
+			err = fmt.Errorf("%w: %s does not start with %s", ErrInvalidContent, it.fileName, PrefixDIRC)
+		}
+	case isPackFile(it.fileName, SuffixPack):
+		if !bytes.HasPrefix(data, packMagic) {
+			err = fmt.Errorf("%w: %s is not a pack file", ErrInvalidContent, it.fileName)
+		}
+	case isPackFile(it.fileName, SuffixPackIdx):
+		if !bytes.HasPrefix(data, packIdxMagic) {
+			err = fmt.Errorf("%w: %s is not a pack index v2", ErrInvalidContent, it.fileName)
+		}
+	case it.isObject:
+		err = validateObjectHeader(data)
+
+		if err != nil {
+			err = fmt.Errorf("%w: %s %v", ErrInvalidContent, it.fileName, err)
+		}
+	case isRefFile(it.fileName):
+		if !regexpRefContent.Match(data) {
+			err = fmt.Errorf("%w: %s is not a ref or hash", ErrInvalidContent, it.fileName)
+		}
+	case looksLikeHtml(data):
+		err = fmt.Errorf("%w: %s is a HTML page", ErrInvalidContent, it.fileName)
+	}
+
+	return
+}
+
+func isRefFile(name string) bool {
+	return name == PathHead || name == PathOrigHead || strings.HasPrefix(name, PathPrefixRefs)
+}
+
+// validateObjectHeader decodes only the beginning of the object, the rest is decoded when references are read.
+func validateObjectHeader(data []byte) (err error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+
+	if err != nil {
+		return
+	}
+
+	defer zr.Close()
+
+	header := make([]byte, objectHeaderMaxSize)
+	n, err := io.ReadFull(zr, header)
+
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+
+	objType, _, found := bytes.Cut(header[:n], []byte(" "))
+
+	if !found {
+		return errors.New("object header is missing")
+	}
+
+	switch string(objType) {
+	case ObjectBlob, ObjectTree, ObjectCommit, ObjectTag:
+		return nil
+	default:
+		return fmt.Errorf("unknown object type '%s'", objType)
+	}
+}
+
+func looksLikeHtml(data []byte) bool {
+	start := data[:min(len(data), 64)]
+	start = bytes.ToLower(bytes.TrimSpace(start))
+
+	for _, prefix := range htmlPrefixes {
+		if bytes.HasPrefix(start, []byte(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/unsecured-company/gitrip/internal/application"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemValidate(t *testing.T) {
+	html := "\n<!DOCTYPE html><html><body>Not found</body></html>"
+	hash := "652c5d72790ba74bd7b83f8b2a63bc942c2c304d"
+	object := "objects/65/2c5d72790ba74bd7b83f8b2a63bc942c2c304d"
+
+	valid := []*Item{
+		createItem(PathHead, "ref: refs/heads/master\n", false),
+		createItem("refs/heads/master", hash+"\n", false),
+		createItem(PathIndex, "DIRC\x00\x00\x00\x02", false),
+		createItem(object, "blob 5\x00hello", true),
+		createItem("objects/pack/pack-"+hash+".pack", "PACK\x00\x00\x00\x02", false),
+		createItem("objects/pack/pack-"+hash+".idx", string(packIdxMagic)+"\x00\x00\x00\x02", false),
+		createItem(PathConfig, "[core]\n\tbare = false\n", false),
+	}
+
+	for _, it := range valid {
+		assert.NoError(t, it.validate(), it.fileName)
+	}
+
+	invalid := []*Item{
+		createItem(PathHead, html, false),
+		createItem("refs/heads/master", "master\n", false),
+		createItem(PathIndex, html, false),
+		createItem(object, html, false),
+		createItem(object, "html 5\x00hello", true),
+		createItem("objects/pack/pack-"+hash+".pack", html, false),
+		createItem("objects/pack/pack-"+hash+".idx", html, false),
+		createItem(PathConfig, html, false),
+	}
+
+	for _, it := range invalid {
+		it.isObject = isObjectFile(it.fileName)
+		assert.ErrorIs(t, it.validate(), ErrInvalidContent, it.fileName)
+	}
+}
+
+func TestNotFoundBaseline(t *testing.T) {
+	page := func(path string, nonce string) []byte {
+		return []byte(`<p>Page /.git/` + path + ` was not found</p><input name="csrf" value="` + nonce + `">`)
+	}
+	probe := func(nonce string) NotFoundResponse {
+		path := notFoundProbePath()
+		return NotFoundResponse{Path: path, Code: 200, ContentType: "text/html; charset=utf-8", Body: page(path, nonce)}
+	}
+	item := func(code int, contentType string, body []byte) *Item {
+		it := createItem(PathConfig, string(body), false)
+		it.netHttpCode = code
+		it.contentType = contentType
+
+		return it
+	}
+
+	nf := NewNotFoundBaseline(probe("a8f5f167f44f4964e6c998dee827110c"), probe("3e8f4f7a"))
+
+	assert.True(t, nf.Matches(item(200, "text/html", page(PathConfig, "c4ca4238a0b923820dcc509a6f75849b"))))
+	assert.False(t, nf.Matches(item(403, "text/html", page(PathConfig, "c4ca4238"))))
+	assert.False(t, nf.Matches(item(200, "application/octet-stream", page(PathConfig, "c4ca4238"))))
+	assert.False(t, nf.Matches(item(200, "text/html", []byte("[core]\n"))))
+
+	other := probe("c4ca4238")
+	other.Code = 404
+	assert.Nil(t, NewNotFoundBaseline(probe("a8f5f167"), other))
+
+	var none *NotFoundBaseline
+	assert.False(t, none.Matches(item(200, "text/html", page(PathConfig, ""))))
+
+	cache := NewNotFoundCache()
+	cnt := 0
+	fetch := func() *NotFoundBaseline { cnt++; return nf }
+	urlP, _ := url.Parse("https://unsecured.company/admin/.git")
+	assert.Equal(t, nf, cache.Get(urlP, fetch))
+	urlP, _ = url.Parse("https://unsecured.company/.git")
+	assert.Equal(t, nf, cache.Get(urlP, fetch))
+	assert.Equal(t, 1, cnt)
+}
+
+func TestNotFoundBaselineKeepsGitFiles(t *testing.T) {
+	content := fmt.Sprintf("blob %d\x00%s", 200, strings.Repeat("x", 200))
+	object := createItem("objects/3b/18e512dba79e4c8300dd08aeb37f8e728b8dad", content, true)
+	object.netHttpCode = 200
+	object.contentType = "application/octet-stream"
+	probe := func(path string) NotFoundResponse {
+		return NotFoundResponse{Path: path, Code: 200, ContentType: "application/octet-stream", Body: bytes.Repeat([]byte{0}, len(object.fileData))}
+	}
+
+	// Binary catch-all is not matched by size.
+	nf := NewNotFoundBaseline(probe(notFoundProbePath()), probe(notFoundProbePath()))
+	assert.False(t, nf.Matches(object))
+
+	app := &application.App{Cfg: &application.Config{}, Out: application.NewOutput(), Ctx: context.Background()}
+	urlP, _ := url.Parse("https://unsecured.company/.git")
+	rp := newRepo(&Dumper{app: app}, urlP)
+	rp.notFound = nf
+	assert.NoError(t, rp.validate(object))
+
+	// Valid objects are kept also when a text catch-all has their size.
+	html := NotFoundResponse{Path: notFoundProbePath(), Code: 200, ContentType: "text/html", Body: bytes.Repeat([]byte("a"), len(object.fileData))}
+	rp.notFound = NewNotFoundBaseline(html, html)
+	object.contentType = "text/html"
+	assert.True(t, rp.notFound.Matches(object))
+	assert.NoError(t, rp.validate(object))
+
+	config := createItem(PathConfig, string(html.Body), false)
+	config.netHttpCode = 200
+	config.contentType = "text/html"
+	assert.ErrorIs(t, rp.validate(config), ErrSoftNotFound)
+}
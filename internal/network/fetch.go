@@ -1,25 +1,46 @@
 package network
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/unsecured-company/gitrip/internal/application"
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+const (
+	FilePerm     = 0644
+	MaxRedirects = 10
+)
+
+var (
+	ErrFileTooLarge        = errors.New("file is larger than the size limit")
+	ErrRangeNotSatisfiable = errors.New("partial download can not be resumed")
 )
 
 type Fetcher struct {
-	out       *application.Output
-	timeout   int
-	userAgent string
-	client    *retryablehttp.Client
+	out          *application.Output
+	userAgent    string
+	header       http.Header
+	cookie       string
+	auth         string // user:pass
+	client       *retryablehttp.Client
+	maxFileSize  int64
+	stallTimeout time.Duration
+	minSpeed     int64 // bytes per second
 }
 
 func NewFetcher(app *application.App) (fetcher *Fetcher) {
@@ -31,19 +52,37 @@ func NewFetcher(app *application.App) (fetcher *Fetcher) {
 	retryClient.Backoff = retryablehttp.DefaultBackoff
 	retryClient.Logger = nil
 
-	retryClient.HTTPClient.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		MaxIdleConns:        application.FetchClientMaxIdleCnt,
-		MaxIdleConnsPerHost: application.FetchClientMaxConnPerHost,
-		IdleConnTimeout:     application.FetchClientIdleConnTimeoutSec * time.Second,
+	timeout := time.Duration(app.Cfg.Timeout) * time.Second
+	dialer := &net.Dialer{Timeout: timeout}
+
+	transport := &http.Transport{
+		Proxy:                 getProxy(app.Cfg.ProxyURL, app.Cfg.Resolved, app.Out),
+		DialContext:           dialContext(dialer, app.Cfg.Resolved, app.Out),
+		TLSClientConfig:       getTLSConfig(app.Cfg.TLS),
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          application.FetchClientMaxIdleCnt,
+		MaxIdleConnsPerHost:   application.FetchClientMaxConnPerHost,
+		IdleConnTimeout:       application.FetchClientIdleConnTimeoutSec * time.Second,
+	}
+
+	retryClient.HTTPClient.Transport = NewHostLimiter(transport, app.Out, app.Cfg.Rps, app.Cfg.MaxPerHost)
+
+	retryClient.HTTPClient.CheckRedirect = getCheckRedirect(app.Cfg.Redirects)
+
+	if app.Cfg.CookieJar != "" {
+		retryClient.HTTPClient.Jar = newCookieJar(app.Cfg.JarCookies)
 	}
 
 	fetcher = &Fetcher{
-		timeout: app.Cfg.Timeout,
-		out:     app.Out,
-		client:  retryClient,
+		out:          app.Out,
+		client:       retryClient,
+		maxFileSize:  app.Cfg.MaxFileSize,
+		stallTimeout: time.Duration(app.Cfg.StallTimeout) * time.Second,
+		minSpeed:     app.Cfg.MinSpeedBps,
+		header:       app.Cfg.Header,
+		cookie:       app.Cfg.Cookie,
+		auth:         app.Cfg.Auth,
 	}
 
 	fetcher.userAgent = app.Cfg.UserAgent
@@ -54,13 +93,174 @@ func NewFetcher(app *application.App) (fetcher *Fetcher) {
 	return
 }
 
+// Fetch reads the whole response into memory, use FetchToFile for files which can be large.
 func (f *Fetcher) Fetch(ctx context.Context, urlStr string, retryTimes int) (content []byte, code int, err error) {
-	for attempt := 0; attempt < retryTimes; attempt++ {
-		// Reset context to ensure a fresh context for each attempt
-		attemptCtx, cancel := context.WithTimeout(ctx, time.Duration(f.timeout)*time.Second)
-		defer cancel()
+	content, code, _, err = f.FetchWithInfo(ctx, urlStr, retryTimes)
+
+	return
+}
+
+// ResponseInfo describes how the response was received.
+type ResponseInfo struct {
+	Chain       []string  // from the requested URL to the final one, empty without redirects
+	Certificate *CertInfo // nil without TLS
+	ContentType string
+}
+
+// FetchWithInfo returns also the redirect chain and the server certificate, info is never nil.
+func (f *Fetcher) FetchWithInfo(ctx context.Context, urlStr string, retryTimes int) (content []byte, code int, info *ResponseInfo, err error) {
+	var buf bytes.Buffer
+	info = &ResponseInfo{}
+
+	_, code, err = f.fetchRetry(ctx, urlStr, retryTimes, func(ctx context.Context) (int64, int, error) {
+		buf.Reset()
+		resp, err := f.do(ctx, urlStr, nil)
+
+		if err != nil {
+			return 0, -1, err
+		}
+
+		defer resp.Body.Close()
+		info.Chain = redirectChain(resp)
+		info.Certificate = NewCertInfo(resp.TLS)
+		info.ContentType = resp.Header.Get("Content-Type")
+		size, err := copyBody(&buf, resp, f.maxFileSize)
+
+		return size, resp.StatusCode, err
+	})
+
+	if err == nil {
+		content = buf.Bytes()
+	}
+
+	return
+}
+
+// FetchToFile streams the response into the file, body larger than maxSize fails with ErrFileTooLarge.
+// Data already in the file are continued with a Range request, servers without range support send it all again.
+func (f *Fetcher) FetchToFile(ctx context.Context, urlStr string, filePath string, maxSize int64, retryTimes int) (size int64, code int, info *ResponseInfo, err error) {
+	var validator string // ETag or Last-Modified of the partial data
+	info = &ResponseInfo{}
+
+	size, code, err = f.fetchRetry(ctx, urlStr, retryTimes, func(ctx context.Context) (int64, int, error) {
+		return f.fetchFileAttempt(ctx, urlStr, filePath, maxSize, &validator, info)
+	})
+
+	return
+}
+
+func (f *Fetcher) fetchFileAttempt(ctx context.Context, urlStr string, filePath string, maxSize int64, validator *string, info *ResponseInfo) (size int64, code int, err error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, FilePerm)
+
+	if err != nil {
+		return 0, -1, err
+	}
+
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return 0, -1, err
+	}
+
+	headers := http.Header{}
+
+	if offset > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+		if *validator != "" {
+			headers.Set("If-Range", *validator)
+		}
+	}
+
+	resp, err := f.do(ctx, urlStr, headers)
+
+	if err != nil {
+		return 0, -1, err
+	}
+
+	defer resp.Body.Close()
+	code = resp.StatusCode
+	info.ContentType = resp.Header.Get("Content-Type")
+
+	if code == http.StatusRequestedRangeNotSatisfiable && offset > 0 && rangeTotal(resp) == offset {
+		return offset, http.StatusOK, nil // Already complete.
+	}
+
+	if code == http.StatusPartialContent && offset > 0 && rangeStart(resp) == offset {
+		f.out.Debugf("(%s) resuming from %d bytes", urlStr, offset)
+		code = http.StatusOK
+	} else if offset > 0 || code == http.StatusPartialContent {
+		if err = file.Truncate(0); err != nil {
+			return
+		}
+
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+
+	if code == http.StatusRequestedRangeNotSatisfiable || code == http.StatusPartialContent {
+		// Partial data were not usable, start again without them.
+		return 0, code, fmt.Errorf("%w: %s", ErrRangeNotSatisfiable, urlStr)
+	}
+
+	*validator = rangeValidator(resp)
+	limit := maxSize
+
+	// The resumed data already fill the limit, the rest can not fit.
+	if maxSize > 0 {
+		limit = maxSize - offset
+
+		if limit <= 0 {
+			return offset, code, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxSize)
+		}
+	}
+
+	written, err := copyBody(file, resp, limit)
+
+	return offset + written, code, err
+}
+
+// rangeValidator returns the value for If-Range, empty when the server does not support ranges.
+func rangeValidator(resp *http.Response) string {
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return ""
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return resp.Header.Get("Last-Modified")
+}
+
+// rangeStart parses "bytes 100-199/200" of the Content-Range header, -1 when it is missing or invalid.
+func rangeStart(resp *http.Response) (start int64) {
+	var end, total int64
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+
+	if err != nil {
+		return -1
+	}
+
+	return
+}
+
+// rangeTotal parses "bytes */200" of the Content-Range header in 416 response, -1 when it is missing or invalid.
+func rangeTotal(resp *http.Response) (total int64) {
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total)
+
+	if err != nil {
+		return -1
+	}
+
+	return
+}
 
-		content, code, err = f.fetchCommon(attemptCtx, urlStr, "")
+func (f *Fetcher) fetchRetry(ctx context.Context, urlStr string, retryTimes int, fetch func(context.Context) (int64, int, error)) (size int64, code int, err error) {
+	for attempt := 0; attempt < retryTimes; attempt++ {
+		size, code, err = fetch(ctx)
 
 		if err == nil {
 			return
@@ -73,84 +273,210 @@ func (f *Fetcher) Fetch(ctx context.Context, urlStr string, retryTimes int) (con
 			f.out.Logf("(%s) Connection error, retry attempt %d", urlStr, attempt+1)
 		case f.isTimeoutError(err):
 			f.out.Logf("(%s) Timeout error, retry attempt %d", urlStr, attempt+1)
+		case errors.Is(err, ErrStalled) || errors.Is(err, ErrTooSlow):
+			f.out.Logf("(%s) %v, retry attempt %d", urlStr, err, attempt+1)
+		case errors.Is(err, ErrRangeNotSatisfiable):
+			f.out.Debugf("(%s) %v, retry attempt %d", urlStr, err, attempt+1)
+			continue
 		default:
 			return
 		}
 
-		backoffDuration := calculateBackoff(attempt)
-		time.Sleep(backoffDuration)
+		if attempt+1 == retryTimes {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, code, ctx.Err()
+		case <-time.After(calculateBackoff(attempt)):
+		}
 	}
 
 	return
 }
 
-func (f *Fetcher) FetchWithIP(ctx context.Context, urlStr string, customIP string) (content []byte, code int, err error) {
-	return f.fetchCommon(ctx, urlStr, customIP)
-}
-
-func (f *Fetcher) fetchCommon(ctx context.Context, urlStr string, customIP string) (content []byte, code int, err error) {
-	code = -1
+func (f *Fetcher) do(ctx context.Context, urlStr string, headers http.Header) (resp *http.Response, err error) {
 	req, err := retryablehttp.NewRequestWithContext(ctx, "GET", urlStr, nil)
 
 	if err != nil {
-		return nil, code, err
+		return
 	}
 
-	req.Header.Set("User-Agent", f.userAgent)
+	f.setHeaders(req.Request, headers)
+
+	resp, err = f.client.Do(req)
 
-	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, code, err
+		return
 	}
 
-	defer resp.Body.Close()
-	code = resp.StatusCode
+	resp.Body = newWatchdog(resp.Body, f.stallTimeout, f.minSpeed)
+
+	if chain := redirectChain(resp); len(chain) > 0 {
+		f.out.Debugf("(%s) redirected: %s", urlStr, strings.Join(chain, " -> "))
+	}
+
+	return
+}
+
+// setHeaders applies --header, --cookie, --auth and the User-Agent, then headers of the request.
+// Go drops Authorization and Cookie headers on redirects to another domain.
+func (f *Fetcher) setHeaders(req *http.Request, headers http.Header) {
+	for name, values := range f.header {
+		req.Header[name] = values
+	}
+
+	if host := f.header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	if f.cookie != "" {
+		req.Header.Add("Cookie", f.cookie)
+	}
+
+	if user, pass, ok := strings.Cut(f.auth, ":"); ok && req.Header.Get("Authorization") == "" {
+		req.SetBasicAuth(user, pass)
+	}
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+}
+
+// newCookieJar holds cookies from --cookie-jar and cookies set by servers.
+func newCookieJar(cookies []*http.Cookie) http.CookieJar {
+	jar, _ := cookiejar.New(nil) // Error is always nil.
+
+	for _, cookie := range cookies {
+		c := *cookie
+		host := strings.TrimPrefix(c.Domain, ".")
 
-	// TODO maybe we should do download directly into a file?
-	//if resp.ContentLength > MaxLength {
+		if !strings.HasPrefix(c.Domain, ".") {
+			c.Domain = "" // host-only
+		}
+
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, []*http.Cookie{&c})
+	}
+
+	return jar
+}
+
+// getCheckRedirect returns redirect policy for --redirects, a redirect which is not followed is returned as the response.
+func getCheckRedirect(policy string) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		switch {
+		case policy == application.RedirectNever:
+			return http.ErrUseLastResponse
+		case policy == application.RedirectSameHost && req.URL.Hostname() != via[0].URL.Hostname():
+			return http.ErrUseLastResponse
+		case len(via) >= MaxRedirects:
+			return fmt.Errorf("stopped after %d redirects", MaxRedirects)
+		}
+
+		return nil
+	}
+}
+
+// redirectChain lists URLs from the first request to the final one, it is empty when there was no redirect.
+func redirectChain(resp *http.Response) (chain []string) {
+	for r := resp.Request; r != nil; {
+		chain = append([]string{r.URL.String()}, chain...)
+
+		if r.Response == nil {
+			break
+		}
+
+		r = r.Response.Request
+	}
 
-	content, err = io.ReadAll(resp.Body)
+	if len(chain) < 2 {
+		return nil
+	}
 
 	return
 }
 
-func (f *Fetcher) createTransport(parsedURL *url.URL, customIP string) *http.Transport {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		// Add connection pooling and keep-alive settings
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		// Disable keep-alive if you want to force new connections
-		// DisableKeepAlives:   true,
+// copyBody fails with ErrFileTooLarge instead of truncating the body, maxSize 0 means no limit.
+func copyBody(w io.Writer, resp *http.Response, maxSize int64) (size int64, err error) {
+	if maxSize <= 0 {
+		return io.Copy(w, resp.Body)
 	}
 
-	dialer := &net.Dialer{
-		Timeout:   time.Duration(f.timeout) * time.Second,
-		KeepAlive: 30 * time.Second, // Explicit keep-alive
+	if resp.ContentLength > maxSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrFileTooLarge, resp.ContentLength)
 	}
 
-	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-		if customIP != "" {
-			host, port, err := net.SplitHostPort(addr)
-			f.out.Debugf("CreateTransport() - Before: %s Error: %v", addr, err)
+	size, err = io.Copy(w, io.LimitReader(resp.Body, maxSize+1))
 
-			if err != nil {
-				return nil, err
-			}
+	if err == nil && size > maxSize {
+		err = fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxSize)
+	}
 
-			if host == parsedURL.Hostname() {
-				addr = net.JoinHostPort(customIP, port)
-				f.out.Debugf("CreateTransport() - After: %s Error: %v", addr, err)
+	return
+}
+
+// dialContext connects to the IP from --resolve or the batch file instead of resolving the host.
+// The address is the proxy when a proxy is used, so the proxy resolves the host.
+func dialContext(dialer *net.Dialer, resolved *utils.SafeMapStrings, out *application.Output) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+
+		if err == nil && resolved != nil {
+			if ip, ok := resolved.Get(application.ResolveKey(host, port)); ok {
+				out.Debugf("Connecting to %s instead of %s", ip, host)
+				addr = net.JoinHostPort(ip, port)
 			}
 		}
 
 		return dialer.DialContext(ctx, network, addr)
 	}
+}
+
+// getProxy returns the proxy from --proxy, HTTP(S)_PROXY and NO_PROXY are used when it is not set.
+// Schemes http, https, socks5 and socks5h are supported by net/http, credentials are taken from the URL.
+func getProxy(proxyURL *url.URL, resolved *utils.SafeMapStrings, out *application.Output) func(*http.Request) (*url.URL, error) {
+	if proxyURL == nil {
+		return bypassResolved(http.ProxyFromEnvironment, resolved, out)
+	}
+
+	return http.ProxyURL(proxyURL)
+}
+
+// bypassResolved connects directly to hosts from --resolve, the proxy from the environment would resolve them itself.
+func bypassResolved(getProxy func(*http.Request) (*url.URL, error), resolved *utils.SafeMapStrings, out *application.Output) func(*http.Request) (*url.URL, error) {
+	var warnOnce sync.Once
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy, err := getProxy(req)
+
+		if proxy == nil || err != nil || resolved == nil || !resolved.Exists(resolveKeyForUrl(req.URL)) {
+			return proxy, err
+		}
+
+		warnOnce.Do(func() {
+			out.Logf("Proxy %s from the environment is not used for hosts from --%s", proxy.Redacted(), application.FlagResolve)
+		})
+
+		return nil, nil
+	}
+}
+
+// resolveKeyForUrl returns the --resolve key with the default port of the scheme.
+func resolveKeyForUrl(urlP *url.URL) string {
+	port := urlP.Port()
+
+	if port == "" && urlP.Scheme == "https" {
+		port = "443"
+	} else if port == "" {
+		port = "80"
+	}
 
-	return transport
+	return application.ResolveKey(urlP.Hostname(), port)
 }
 
 func (f *Fetcher) isErrNoHost(err error) bool {
@@ -158,15 +484,15 @@ func (f *Fetcher) isErrNoHost(err error) bool {
 }
 
 func (f *Fetcher) isConnectionError(err error) bool {
-	netErr, ok := err.(net.Error)
+	var netErr net.Error
 
-	return ok && netErr.Temporary()
+	return errors.As(err, &netErr) && netErr.Temporary()
 }
 
 func (f *Fetcher) isTimeoutError(err error) bool {
-	netErr, ok := err.(net.Error)
+	var netErr net.Error
 
-	return ok && netErr.Timeout()
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 func calculateBackoff(attempt int) time.Duration {
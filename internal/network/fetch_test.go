@@ -0,0 +1,151 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unsecured-company/gitrip/internal/application"
+	"github.com/unsecured-company/gitrip/internal/utils"
+)
+
+func TestFetchToFileResumeOverLimit(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 2))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		partial int
+		maxSize int64
+		size    int64
+		tooBig  bool
+	}{
+		{"resumed", 5, 0, 20, false},
+		{"resumed within limit", 5, 20, 20, false},
+		{"resumed data fill the limit", 10, 10, 10, true},
+		{"resumed data over the limit", 12, 10, 12, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.part")
+			require.NoError(t, os.WriteFile(path, content[:tt.partial], FilePerm))
+
+			size, _, _, err := createFetcher().FetchToFile(context.Background(), server.URL, path, tt.maxSize, 1)
+
+			assert.Equal(t, tt.tooBig, errors.Is(err, ErrFileTooLarge), err)
+			assert.Equal(t, tt.size, size)
+		})
+	}
+}
+
+func createFetcher() *Fetcher {
+	client := retryablehttp.NewClient()
+	client.RetryMax = 0
+	client.Logger = nil
+
+	return &Fetcher{out: application.NewOutput(), client: client, userAgent: "test"}
+}
+
+func TestProxyBypassesResolvedHosts(t *testing.T) {
+	envProxy, _ := url.Parse("http://proxy.local:3128")
+	resolved := utils.NewSafeMapStrings()
+	resolved.AddKeyValue(application.ResolveKey("origin.local", "443"), "203.0.113.10")
+	resolved.AddKeyValue(application.ResolveKey("origin.local", "8080"), "203.0.113.10")
+	proxy := bypassResolved(http.ProxyURL(envProxy), resolved, application.NewOutput())
+
+	tests := []struct {
+		url    string
+		direct bool
+	}{
+		{"https://origin.local/.git/HEAD", true},
+		{"https://ORIGIN.local:443/.git/HEAD", true},
+		{"http://origin.local:8080/.git/HEAD", true},
+		{"http://origin.local/.git/HEAD", false},
+		{"https://other.local/.git/HEAD", false},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		require.NoError(t, err)
+
+		proxyURL, err := proxy(req)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.direct, proxyURL == nil, tt.url)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	// The target is requested as localhost and the redirecting server as 127.0.0.1 to be another host.
+	targetUrl, _ := url.Parse(target.URL)
+	crossUrl := "http://localhost:" + targetUrl.Port() + "/file"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cross":
+			http.Redirect(w, r, crossUrl, http.StatusFound)
+		case "/same":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		policy string
+		path   string
+		code   int
+		chain  int
+		err    bool
+	}{
+		{application.RedirectNever, "/same", http.StatusFound, 0, false},
+		{application.RedirectNever, "/cross", http.StatusFound, 0, false},
+		{application.RedirectSameHost, "/same", http.StatusOK, 2, false},
+		{application.RedirectSameHost, "/cross", http.StatusFound, 0, false},
+		{application.RedirectSameHost, "/loop", 0, 0, true},
+		{application.RedirectFollow, "/same", http.StatusOK, 2, false},
+		{application.RedirectFollow, "/cross", http.StatusOK, 2, false},
+		{application.RedirectFollow, "/loop", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+tt.path, func(t *testing.T) {
+			client := &http.Client{CheckRedirect: getCheckRedirect(tt.policy)}
+
+			resp, err := client.Get(server.URL + tt.path)
+
+			if tt.err {
+				assert.ErrorContains(t, err, "stopped after")
+				return
+			}
+
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			assert.Len(t, redirectChain(resp), tt.chain)
+		})
+	}
+}
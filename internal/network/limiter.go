@@ -0,0 +1,230 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+const (
+	MaxRetryAfter     = 5 * time.Minute
+	slowdownStep      = 250 * time.Millisecond // first delay after an error
+	slowdownMax       = 30 * time.Second
+	slowdownRecovered = 50 * time.Millisecond // smaller delay is dropped
+)
+
+// HostLimiter paces requests per host: token bucket for --rps, semaphore for --max-concurrent-per-host,
+// waits for Retry-After of 429 and 503 responses and slows down when the host returns errors.
+// It is a RoundTripper, so retries and redirects are paced too.
+type HostLimiter struct {
+	next          http.RoundTripper
+	out           *application.Output
+	rps           float64
+	maxConcurrent int
+	mu            sync.Mutex
+	hosts         map[string]*hostState
+}
+
+type hostState struct {
+	tokens    float64
+	refilled  time.Time
+	notBefore time.Time     // Retry-After or slow-down
+	slowdown  time.Duration // grows with errors, shrinks with successful responses
+	slots     chan struct{} // nil without concurrency limit
+}
+
+func NewHostLimiter(next http.RoundTripper, out *application.Output, rps float64, maxConcurrent int) *HostLimiter {
+	return &HostLimiter{
+		next:          next,
+		out:           out,
+		rps:           rps,
+		maxConcurrent: maxConcurrent,
+		hosts:         make(map[string]*hostState),
+	}
+}
+
+func (hl *HostLimiter) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	host := strings.ToLower(req.URL.Hostname())
+	hs := hl.host(host)
+	err = hl.acquire(req.Context(), hs)
+
+	if err != nil {
+		return
+	}
+
+	resp, err = hl.next.RoundTrip(req)
+	hl.observe(host, hs, resp, err)
+
+	if err != nil {
+		hl.release(hs)
+		return
+	}
+
+	// The slot is held until the body is read.
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { hl.release(hs) }}
+
+	return
+}
+
+func (hl *HostLimiter) host(host string) (hs *hostState) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	hs, ok := hl.hosts[host]
+
+	if !ok {
+		hs = &hostState{tokens: hl.burst(), refilled: time.Now()}
+
+		if hl.maxConcurrent > 0 {
+			hs.slots = make(chan struct{}, hl.maxConcurrent)
+		}
+
+		hl.hosts[host] = hs
+	}
+
+	return
+}
+
+func (hl *HostLimiter) burst() float64 {
+	if hl.rps < 1 {
+		return 1
+	}
+
+	return hl.rps
+}
+
+func (hl *HostLimiter) acquire(ctx context.Context, hs *hostState) (err error) {
+	if hs.slots != nil {
+		select {
+		case hs.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		wait := hl.reserve(hs)
+
+		if wait <= 0 {
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			hl.release(hs)
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before trying again.
+func (hl *HostLimiter) reserve(hs *hostState) (wait time.Duration) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Before(hs.notBefore) {
+		return hs.notBefore.Sub(now)
+	}
+
+	if hl.rps <= 0 {
+		hs.notBefore = now.Add(hs.slowdown)
+		return 0
+	}
+
+	hs.tokens = min(hl.burst(), hs.tokens+now.Sub(hs.refilled).Seconds()*hl.rps)
+	hs.refilled = now
+
+	if hs.tokens < 1 {
+		return time.Duration((1 - hs.tokens) / hl.rps * float64(time.Second))
+	}
+
+	hs.tokens--
+	hs.notBefore = now.Add(hs.slowdown)
+
+	return 0
+}
+
+func (hl *HostLimiter) release(hs *hostState) {
+	if hs.slots != nil {
+		<-hs.slots
+	}
+}
+
+// observe adjusts the slow-down by the response, 429, 5xx and connection errors count as errors.
+func (hl *HostLimiter) observe(host string, hs *hostState, resp *http.Response, err error) {
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return
+	}
+
+	isError := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+
+	var retryAfter time.Duration
+
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	switch {
+	case isError && hs.slowdown == 0:
+		hs.slowdown = slowdownStep
+	case isError:
+		hs.slowdown = min(hs.slowdown*2, slowdownMax)
+	default:
+		hs.slowdown /= 2
+
+		if hs.slowdown < slowdownRecovered {
+			hs.slowdown = 0
+		}
+	}
+
+	if isError {
+		hl.out.Debugf("(%s) slowing down, %s between requests", host, hs.slowdown)
+	}
+
+	if until := time.Now().Add(retryAfter); retryAfter > 0 && until.After(hs.notBefore) {
+		hs.notBefore = until
+		hl.out.Logf("(%s) Retry-After, waiting %s", host, retryAfter)
+	}
+}
+
+// parseRetryAfter reads seconds or HTTP date, the result is capped by MaxRetryAfter.
+func parseRetryAfter(value string) (wait time.Duration) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	}
+
+	return max(0, min(wait, MaxRetryAfter))
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (rb *releaseBody) Close() error {
+	rb.once.Do(rb.release)
+
+	return rb.ReadCloser.Close()
+}
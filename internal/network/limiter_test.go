@@ -0,0 +1,110 @@
+package network
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unsecured-company/gitrip/internal/application"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{" 5 ", 5 * time.Second, 5 * time.Second},
+		{"-5", 0, 0},
+		{"86400", MaxRetryAfter, MaxRetryAfter},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), MaxRetryAfter, MaxRetryAfter},
+	}
+
+	for _, tt := range tests {
+		wait := parseRetryAfter(tt.value)
+
+		assert.GreaterOrEqual(t, wait, tt.min, tt.value)
+		assert.LessOrEqual(t, wait, tt.max, tt.value)
+	}
+}
+
+func TestHostLimiterTokenBucket(t *testing.T) {
+	tests := []struct {
+		rps      float64
+		requests int // without waiting
+		waits    bool
+	}{
+		{0, 100, false},
+		{0.5, 1, true},
+		{2, 2, true},
+		{10, 10, true},
+	}
+
+	for _, tt := range tests {
+		hl := NewHostLimiter(nil, application.NewOutput(), tt.rps, 0)
+		hs := hl.host("unsecured.company")
+
+		for i := 0; i < tt.requests; i++ {
+			assert.Zero(t, hl.reserve(hs), "rps %g request %d", tt.rps, i+1)
+		}
+
+		wait := hl.reserve(hs)
+		assert.Equal(t, tt.waits, wait > 0, "rps %g", tt.rps)
+
+		if tt.waits {
+			assert.LessOrEqual(t, wait, time.Duration(float64(time.Second)/tt.rps), "rps %g", tt.rps)
+		}
+	}
+
+	// Tokens refill by the time passed.
+	hl := NewHostLimiter(nil, application.NewOutput(), 10, 0)
+	hs := hl.host("unsecured.company")
+	hs.tokens = 0
+	hs.refilled = time.Now().Add(-time.Second)
+
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, hl.reserve(hs))
+	}
+
+	assert.Positive(t, hl.reserve(hs))
+}
+
+func TestHostLimiterSlowdown(t *testing.T) {
+	hl := NewHostLimiter(nil, application.NewOutput(), 0, 0)
+	hs := hl.host("unsecured.company")
+	responses := []struct {
+		code     int
+		err      error
+		slowdown time.Duration
+	}{
+		{http.StatusOK, nil, 0},
+		{http.StatusInternalServerError, nil, slowdownStep},
+		{0, errors.New("connection reset"), 2 * slowdownStep},
+		{http.StatusNotFound, nil, slowdownStep},
+		{http.StatusOK, nil, slowdownStep / 2},
+		{http.StatusOK, nil, slowdownStep / 4},
+		{http.StatusOK, nil, 0},
+	}
+
+	for i, r := range responses {
+		var resp *http.Response
+
+		if r.err == nil {
+			resp = &http.Response{StatusCode: r.code, Header: http.Header{}}
+		}
+
+		hl.observe("unsecured.company", hs, resp, r.err)
+		assert.Equal(t, r.slowdown, hs.slowdown, "response %d", i+1)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"60"}}}
+	hl.observe("unsecured.company", hs, resp, nil)
+	assert.Greater(t, hl.reserve(hs), 59*time.Second)
+}
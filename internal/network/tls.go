@@ -0,0 +1,44 @@
+package network
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// CertInfo is the server certificate, its names often reveal more hosts to check.
+type CertInfo struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	DNSNames []string  `json:"dns_names,omitempty"`
+	IPs      []string  `json:"ip_addresses,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+func NewCertInfo(state *tls.ConnectionState) (ci *CertInfo) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert := state.PeerCertificates[0]
+	ci = &CertInfo{
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		DNSNames: cert.DNSNames,
+		NotAfter: cert.NotAfter,
+	}
+
+	for _, ip := range cert.IPAddresses {
+		ci.IPs = append(ci.IPs, ip.String())
+	}
+
+	return
+}
+
+// getTLSConfig returns the config from the TLS flags, without flags certificates are not verified.
+func getTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	if tlsConfig == nil {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return tlsConfig.Clone()
+}
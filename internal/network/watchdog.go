@@ -0,0 +1,125 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	watchdogTick      = time.Second
+	watchdogSpeedSpan = 10 * time.Second // average speed is measured over this span
+)
+
+var (
+	ErrStalled = errors.New("transfer stalled")
+	ErrTooSlow = errors.New("transfer too slow")
+)
+
+// watchdog fails a body read which makes no progress for stallTimeout or is slower than minSpeed.
+// The body is closed to unblock the read, which then returns the cause.
+type watchdog struct {
+	body      io.ReadCloser
+	read      atomic.Int64
+	mu        sync.Mutex
+	cause     error
+	done      chan struct{}
+	closeOnce sync.Once
+	tick      time.Duration
+	speedSpan time.Duration
+}
+
+func newWatchdog(body io.ReadCloser, stallTimeout time.Duration, minSpeed int64) io.ReadCloser {
+	if stallTimeout <= 0 && minSpeed <= 0 {
+		return body
+	}
+
+	wd := &watchdog{
+		body:      body,
+		done:      make(chan struct{}),
+		tick:      watchdogTick,
+		speedSpan: watchdogSpeedSpan,
+	}
+
+	go wd.run(stallTimeout, minSpeed)
+
+	return wd
+}
+
+func (wd *watchdog) Read(p []byte) (n int, err error) {
+	n, err = wd.body.Read(p)
+	wd.read.Add(int64(n))
+
+	if err != nil {
+		if cause := wd.getCause(); cause != nil {
+			err = cause
+		}
+	}
+
+	return
+}
+
+func (wd *watchdog) Close() error {
+	wd.closeOnce.Do(func() { close(wd.done) })
+
+	return wd.body.Close()
+}
+
+func (wd *watchdog) run(stallTimeout time.Duration, minSpeed int64) {
+	ticker := time.NewTicker(wd.tick)
+	defer ticker.Stop()
+
+	var lastRead, spanRead int64
+	lastProgress := time.Now()
+	spanStart := lastProgress
+
+	for {
+		select {
+		case <-wd.done:
+			return
+		case now := <-ticker.C:
+			read := wd.read.Load()
+
+			if read != lastRead {
+				lastRead = read
+				lastProgress = now
+			}
+
+			if stallTimeout > 0 && now.Sub(lastProgress) >= stallTimeout {
+				wd.fail(fmt.Errorf("%w: no data for %s", ErrStalled, stallTimeout))
+				return
+			}
+
+			if minSpeed <= 0 || now.Sub(spanStart) < wd.speedSpan {
+				continue
+			}
+
+			speed := int64(float64(read-spanRead) / now.Sub(spanStart).Seconds())
+
+			if speed < minSpeed {
+				wd.fail(fmt.Errorf("%w: %d B/s", ErrTooSlow, speed))
+				return
+			}
+
+			spanStart, spanRead = now, read
+		}
+	}
+}
+
+func (wd *watchdog) fail(cause error) {
+	wd.mu.Lock()
+	wd.cause = cause
+	wd.mu.Unlock()
+
+	_ = wd.body.Close()
+}
+
+func (wd *watchdog) getCause() error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	return wd.cause
+}
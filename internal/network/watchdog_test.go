@@ -0,0 +1,78 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunk        int
+		chunks       int
+		stallTimeout time.Duration
+		minSpeed     int64
+		err          error
+	}{
+		{"stalled", 0, 0, 50 * time.Millisecond, 0, ErrStalled},
+		{"steady above min speed", 100, 30, 500 * time.Millisecond, 1000, nil},
+		{"below min speed", 1, 100, time.Second, 1000, ErrTooSlow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := slowBody(tt.chunk, tt.chunks)
+			defer body.Close()
+
+			data, err := io.ReadAll(createWatchdog(body, tt.stallTimeout, tt.minSpeed))
+
+			if tt.err == nil {
+				assert.NoError(t, err)
+				assert.Len(t, data, tt.chunk*tt.chunks)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+// createWatchdog checks the body more often than the default watchdog to keep the tests short.
+func createWatchdog(body io.ReadCloser, stallTimeout time.Duration, minSpeed int64) io.ReadCloser {
+	wd := &watchdog{
+		body:      body,
+		done:      make(chan struct{}),
+		tick:      10 * time.Millisecond,
+		speedSpan: 100 * time.Millisecond,
+	}
+
+	go wd.run(stallTimeout, minSpeed)
+
+	return wd
+}
+
+// slowBody sends a chunk every 10 ms, without chunks it only blocks until closed.
+func slowBody(chunk int, chunks int) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		if chunks == 0 {
+			return
+		}
+
+		for i := 0; i < chunks; i++ {
+			time.Sleep(10 * time.Millisecond)
+
+			if _, err := writer.Write(bytes.Repeat([]byte("x"), chunk)); err != nil {
+				return
+			}
+		}
+
+		_ = writer.Close()
+	}()
+
+	return reader
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const prefixHttpOnly = "#HttpOnly_"
+
+// ParseCookieFile reads cookies in the Netscape cookies.txt format used by curl and browser extensions.
+// Domain of cookies for subdomains starts with a dot, host-only cookies have it without the dot.
+func ParseCookieFile(path string) (cookies []*http.Cookie, err error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		// Trailing tab is an empty value, only the line end is trimmed.
+		line := strings.TrimLeft(strings.TrimRight(scanner.Text(), "\r"), " ")
+		httpOnly := strings.HasPrefix(line, prefixHttpOnly)
+		line = strings.TrimPrefix(line, prefixHttpOnly)
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab separated fields, got %d", path, lineNo, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiration '%s'", path, lineNo, fields[4])
+		}
+
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+
+		cookie.Domain = strings.TrimPrefix(cookie.Domain, ".")
+
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = "." + cookie.Domain
+		}
+
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+
+		cookies = append(cookies, cookie)
+	}
+
+	err = scanner.Err()
+
+	return
+}
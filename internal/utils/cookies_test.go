@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCookieFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		cookies []*http.Cookie
+		isErr   bool
+	}{
+		{"empty", "# Netscape HTTP Cookie File\n\n", nil, false},
+		{
+			"host only",
+			"unsecured.company\tFALSE\t/\tFALSE\t0\tsession\tabc\n",
+			[]*http.Cookie{{Domain: "unsecured.company", Path: "/", Name: "session", Value: "abc"}},
+			false,
+		},
+		{
+			"subdomains, secure and expiring",
+			".unsecured.company\tTRUE\t/admin\tTRUE\t1893456000\ttoken\tx=y\n",
+			[]*http.Cookie{{Domain: ".unsecured.company", Path: "/admin", Secure: true, Name: "token", Value: "x=y", Expires: time.Unix(1893456000, 0)}},
+			false,
+		},
+		{
+			"subdomains without dot",
+			"unsecured.company\tTRUE\t/\tFALSE\t0\tid\t1\n",
+			[]*http.Cookie{{Domain: ".unsecured.company", Path: "/", Name: "id", Value: "1"}},
+			false,
+		},
+		{
+			"http only",
+			"#HttpOnly_unsecured.company\tFALSE\t/\tFALSE\t0\tsid\t2\n",
+			[]*http.Cookie{{Domain: "unsecured.company", Path: "/", Name: "sid", Value: "2", HttpOnly: true}},
+			false,
+		},
+		{
+			"empty value",
+			"unsecured.company\tFALSE\t/\tFALSE\t0\tempty\t\n",
+			[]*http.Cookie{{Domain: "unsecured.company", Path: "/", Name: "empty"}},
+			false,
+		},
+		{
+			"windows line ends",
+			"# comment\r\nunsecured.company\tFALSE\t/\tFALSE\t0\tid\t3\r\n",
+			[]*http.Cookie{{Domain: "unsecured.company", Path: "/", Name: "id", Value: "3"}},
+			false,
+		},
+		{"missing field", "unsecured.company\tFALSE\t/\tFALSE\t0\tsession\n", nil, true},
+		{"invalid expiration", "unsecured.company\tFALSE\t/\tFALSE\tnever\tsession\tabc\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cookies.txt")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			cookies, err := ParseCookieFile(path)
+
+			if tt.isErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.cookies, cookies)
+			}
+		})
+	}
+
+	_, err := ParseCookieFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -70,13 +70,6 @@ func (sm *SafeMapStrings) PullRand() (key string, value string) {
 	return
 }
 
-/*
-func (sm *SafeMapStrings) Delete(key string) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	delete(sm.values, key)
-}
-
 func (sm *SafeMapStrings) Keys() []string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -88,4 +81,11 @@ func (sm *SafeMapStrings) Keys() []string {
 
 	return keys
 }
+
+/*
+func (sm *SafeMapStrings) Delete(key string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.values, key)
+}
 */
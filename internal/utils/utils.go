@@ -5,6 +5,7 @@ import (
 	"compress/zlib"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -23,6 +24,29 @@ func SizeToHumanReadable(size int64) string {
 	return fmt.Sprintf("%.2f %s", floatSize, units[i])
 }
 
+// HumanReadableToSize parses sizes like "500", "10KB", "1.5 GB", units are powers of 1024.
+func HumanReadableToSize(sizeStr string) (size int64, err error) {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	str := strings.ToUpper(strings.TrimSpace(sizeStr))
+	multiplier := float64(1)
+
+	for i := len(units) - 1; i >= 0; i-- {
+		if strings.HasSuffix(str, units[i]) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, units[i]))
+			multiplier = float64(int64(1) << (10 * i))
+			break
+		}
+	}
+
+	num, err := strconv.ParseFloat(str, 64)
+
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", sizeStr)
+	}
+
+	return int64(num * multiplier), nil
+}
+
 func UrlStrToFolderName(urlStr string) (dirName string, err error) {
 	urlObj, err := url.Parse(urlStr)
 
@@ -100,6 +124,64 @@ func ParseUrlOrDomain(input string) (urlP *url.URL, err error) {
 	return url.Parse(input)
 }
 
+// ParseBatchLine splits a batch file line into URL, port and IP columns, separated by commas or whitespace.
+// Port and IP are optional, port "-" is the same as empty.
+// A comma separates a column only when the value after it is a port or IP, so URLs may contain commas.
+func ParseBatchLine(line string) (urlStr string, port string, ip string) {
+	columns := splitBatchCommas(strings.TrimSpace(line))
+
+	if len(columns) < 2 {
+		columns = strings.Fields(line)
+	}
+
+	for i, column := range columns {
+		column = strings.TrimSpace(column)
+
+		if column == "-" {
+			column = ""
+		}
+
+		switch i {
+		case 0:
+			urlStr = column
+		case 1:
+			port = column
+		case 2:
+			ip = column
+		}
+	}
+
+	return
+}
+
+// splitBatchCommas takes up to two port or IP columns from the end of the line.
+func splitBatchCommas(line string) (columns []string) {
+	rest := line
+
+	for len(columns) < 2 {
+		pos := strings.LastIndex(rest, ",")
+
+		if pos < 0 || !isBatchColumn(strings.TrimSpace(rest[pos+1:])) {
+			break
+		}
+
+		columns = append([]string{rest[pos+1:]}, columns...)
+		rest = rest[:pos]
+	}
+
+	return append([]string{rest}, columns...)
+}
+
+func isBatchColumn(value string) bool {
+	if value == "" || value == "-" || net.ParseIP(value) != nil {
+		return true
+	}
+
+	port, err := strconv.Atoi(value)
+
+	return err == nil && port > 0 && port <= 65535
+}
+
 // GetUrls parses a URL or domain. In case of domain returns both http(s).
 func GetUrls(input string) (urls []*url.URL, err error) {
 	if !strings.Contains(input, "://") && !strings.HasPrefix(input, "//") {
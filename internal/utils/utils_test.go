@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		urlStr string
+		port   string
+		ip     string
+	}{
+		{"example.com", "example.com", "", ""},
+		{"example.com,8080,10.0.0.1", "example.com", "8080", "10.0.0.1"},
+		{"example.com, -, 10.0.0.1", "example.com", "", "10.0.0.1"},
+		{"example.com,,::1", "example.com", "", "::1"},
+		{"example.com 8080 10.0.0.1", "example.com", "8080", "10.0.0.1"},
+		{"https://example.com/a,b/.git", "https://example.com/a,b/.git", "", ""},
+		{"https://example.com/a,b/.git,8443", "https://example.com/a,b/.git", "8443", ""},
+		{"https://example.com/a,b/.git 8443 10.0.0.1", "https://example.com/a,b/.git", "8443", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		urlStr, port, ip := ParseBatchLine(tt.line)
+
+		assert.Equal(t, tt.urlStr, urlStr, tt.line)
+		assert.Equal(t, tt.port, port, tt.line)
+		assert.Equal(t, tt.ip, ip, tt.line)
+	}
+}
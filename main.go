@@ -24,6 +24,7 @@ func main() {
 	if !mErr.HasErrors() && gr.app.Cfg.Command != application.CmdHelp {
 		gr.app.Cfg.PrintConfigurationText(gr.app.Out)
 		mErr.Add(gr.Run())
+		gr.app.Out.Flush()
 	}
 
 	if mErr.HasErrors() {
@@ -40,6 +41,8 @@ func (gr *GitRip) Run() (err error) {
 		err = gr.runFetch()
 	case application.CmdIndex:
 		err = git.RunIndexDump(gr.app)
+	case application.CmdCheckout:
+		err = git.RunCheckout(gr.app)
 	case application.CmdHelp, "":
 		os.Exit(0)
 	default: